@@ -0,0 +1,104 @@
+package book
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+
+	. "github.com/amanjpro/zahak/engine"
+)
+
+const ENTRY_SIZE = 16
+
+type BookEntry struct {
+	Key    uint64
+	Move   uint16
+	Weight uint16
+	Learn  uint32
+}
+
+type Book struct {
+	entries []BookEntry
+}
+
+func LoadBook(path string) (*Book, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%ENTRY_SIZE != 0 {
+		return nil, fmt.Errorf("%s is not a valid polyglot book, size %d is not a multiple of %d", path, len(data), ENTRY_SIZE)
+	}
+	entries := make([]BookEntry, len(data)/ENTRY_SIZE)
+	for i := 0; i < len(entries); i++ {
+		chunk := data[i*ENTRY_SIZE : (i+1)*ENTRY_SIZE]
+		entries[i] = BookEntry{
+			binary.BigEndian.Uint64(chunk[0:8]),
+			binary.BigEndian.Uint16(chunk[8:10]),
+			binary.BigEndian.Uint16(chunk[10:12]),
+			binary.BigEndian.Uint32(chunk[12:16]),
+		}
+	}
+	return &Book{entries}, nil
+}
+
+func (b *Book) Size() int {
+	return len(b.entries)
+}
+
+// Entries returns all the entries of a key, books are sorted by key, so
+// we can binary search for the first one
+func (b *Book) Entries(key uint64) []BookEntry {
+	first := sort.Search(len(b.entries), func(i int) bool {
+		return b.entries[i].Key >= key
+	})
+	last := first
+	for last < len(b.entries) && b.entries[last].Key == key {
+		last++
+	}
+	return b.entries[first:last]
+}
+
+// Probe looks up the position in the book, it either picks the move with the
+// highest weight, or a random move where the chance of every move is proportional
+// to its weight
+func (b *Book) Probe(position *Position, bestMove bool) (Move, bool) {
+	return b.probe(position, bestMove, rand.Intn)
+}
+
+// ProbeRandom picks a random move like Probe, but with the given source of randomness,
+// so that the picks can be reproduced
+func (b *Book) ProbeRandom(position *Position, random *rand.Rand) (Move, bool) {
+	return b.probe(position, false, random.Intn)
+}
+
+func (b *Book) probe(position *Position, bestMove bool, intn func(int) int) (Move, bool) {
+	entries := b.Entries(PolyglotHash(position))
+	if len(entries) == 0 {
+		return Move{Source: NoSquare, Destination: NoSquare}, false
+	}
+
+	total := 0
+	best := entries[0]
+	for _, entry := range entries {
+		total += int(entry.Weight)
+		if entry.Weight > best.Weight {
+			best = entry
+		}
+	}
+
+	if bestMove || total == 0 {
+		return DecodeMove(position, best.Move)
+	}
+
+	pick := intn(total)
+	for _, entry := range entries {
+		pick -= int(entry.Weight)
+		if pick < 0 {
+			return DecodeMove(position, entry.Move)
+		}
+	}
+	return DecodeMove(position, best.Move)
+}
@@ -0,0 +1,130 @@
+package book
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/amanjpro/zahak/engine"
+)
+
+func TestPolyglotHash(t *testing.T) {
+	tests := []struct {
+		moves    []string
+		expected uint64
+	}{
+		{[]string{}, 0x463b96181691fc9c},
+		{[]string{"e2e4"}, 0x823c9b50fd114196},
+		{[]string{"e2e4", "d7d5"}, 0x0756b94461c50fb0},
+		{[]string{"e2e4", "d7d5", "e4e5"}, 0x662fafb965db29d4},
+		{[]string{"e2e4", "d7d5", "e4e5", "f7f5"}, 0x22a48b5a8e47ff78},
+		{[]string{"e2e4", "d7d5", "e4e5", "f7f5", "e1e2"}, 0x652a607ca3f242c1},
+		{[]string{"e2e4", "d7d5", "e4e5", "f7f5", "e1e2", "e8f7"}, 0x00fdd303c946bdd9},
+		{[]string{"a2a4", "b7b5", "h2h4", "b5b4", "c2c4"}, 0x3c8123ea7b067637},
+		{[]string{"a2a4", "b7b5", "h2h4", "b5b4", "c2c4", "b4c3", "a1a2"}, 0x742ec75da0e25edc},
+	}
+
+	for _, test := range tests {
+		game := FromFen(startFen, false)
+		for _, move := range game.Position().ParseMoves(test.moves) {
+			game.Move(move)
+		}
+		actual := PolyglotHash(game.Position())
+		if actual != test.expected {
+			t.Errorf("Unexpected polyglot key for %v:%s\n", test.moves,
+				fmt.Sprintf("Expected: %x\nGot: %x\n", test.expected, actual))
+		}
+	}
+}
+
+func TestEncodeCastlingMove(t *testing.T) {
+	game := FromFen("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", false)
+	position := game.Position()
+	kingSide := Move{E1, G1, NoType, KingSideCastle}
+	queenSide := Move{E1, C1, NoType, QueenSideCastle}
+
+	if EncodeMove(kingSide) != uint16(H1)|uint16(E1)<<6 {
+		t.Errorf("King side castling is not encoded as king takes rook")
+	}
+	if EncodeMove(queenSide) != uint16(A1)|uint16(E1)<<6 {
+		t.Errorf("Queen side castling is not encoded as king takes rook")
+	}
+
+	decoded, ok := DecodeMove(position, EncodeMove(kingSide))
+	if !ok || decoded != kingSide {
+		t.Errorf("Unexpected decoded move:%s\n", fmt.Sprintf("Expected: %s\nGot: %s\n", kingSide.ToString(), decoded.ToString()))
+	}
+}
+
+func TestProbeBook(t *testing.T) {
+	game := FromFen(startFen, false)
+	position := game.Position()
+	key := PolyglotHash(position)
+	e4 := Move{E2, E4, NoType, 0}
+	d4 := Move{D2, D4, NoType, 0}
+
+	dir, err := ioutil.TempDir("", "zahak-book")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "book.bin")
+
+	data := make([]byte, 0, 3*ENTRY_SIZE)
+	for _, entry := range []BookEntry{
+		{key - 1, EncodeMove(d4), 1, 0},
+		{key, EncodeMove(d4), 1, 0},
+		{key, EncodeMove(e4), 10, 0},
+	} {
+		chunk := make([]byte, ENTRY_SIZE)
+		binary.BigEndian.PutUint64(chunk[0:8], entry.Key)
+		binary.BigEndian.PutUint16(chunk[8:10], entry.Move)
+		binary.BigEndian.PutUint16(chunk[10:12], entry.Weight)
+		binary.BigEndian.PutUint32(chunk[12:16], entry.Learn)
+		data = append(data, chunk...)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	book, err := LoadBook(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(book.Entries(key)) != 2 {
+		t.Errorf("Expected 2 entries for the starting position, got %d", len(book.Entries(key)))
+	}
+
+	mv, ok := book.Probe(position, true)
+	if !ok || mv != e4 {
+		t.Errorf("Unexpected book move:%s\n", fmt.Sprintf("Expected: %s\nGot: %s\n", e4.ToString(), mv.ToString()))
+	}
+
+	for i := 0; i < 20; i++ {
+		mv, ok = book.Probe(position, false)
+		if !ok || (mv != e4 && mv != d4) {
+			t.Errorf("Unexpected weighted book move: %s", mv.ToString())
+		}
+	}
+
+	// The same seed picks the same moves
+	first := rand.New(rand.NewSource(3))
+	second := rand.New(rand.NewSource(3))
+	for i := 0; i < 20; i++ {
+		mv, ok = book.ProbeRandom(position, first)
+		other, _ := book.ProbeRandom(position, second)
+		if !ok || mv != other {
+			t.Errorf("Expected the same random book move, got %s and %s", mv.ToString(), other.ToString())
+		}
+	}
+
+	game = FromFen("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", false)
+	if _, ok := book.Probe(game.Position(), true); ok {
+		t.Errorf("Expected no book move for a position that is not in the book")
+	}
+}
@@ -0,0 +1,204 @@
+package book
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	. "github.com/amanjpro/zahak/engine"
+)
+
+const startFen = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+type BuilderOptions struct {
+	MaxPly   int      // Only the first MaxPly half-moves of every game are added
+	MinElo   int      // Both players should be rated at least MinElo, ignored if 0
+	MinCount int      // A move should be played at least MinCount times to be in the book
+	Results  []string // Only games that ended with one of these results are added
+}
+
+type moveStats struct {
+	count  int
+	wins   int
+	draws  int
+	losses int
+}
+
+// The score of a move, from the perspective of the side that played it
+func (s *moveStats) score() int {
+	return 2*s.wins + s.draws
+}
+
+type BookBuilder struct {
+	options   BuilderOptions
+	positions map[uint64]map[uint16]*moveStats
+	games     int
+}
+
+func NewBookBuilder(options BuilderOptions) *BookBuilder {
+	return &BookBuilder{
+		options,
+		make(map[uint64]map[uint16]*moveStats, 100_000),
+		0,
+	}
+}
+
+func (b *BookBuilder) Games() int {
+	return b.games
+}
+
+func (b *BookBuilder) accepts(game *PGNGame) bool {
+	result := game.Result()
+	accepted := false
+	for _, r := range b.options.Results {
+		if r == result {
+			accepted = true
+			break
+		}
+	}
+	if !accepted {
+		return false
+	}
+	if b.options.MinElo > 0 {
+		whiteElo, err := strconv.Atoi(game.Tags["WhiteElo"])
+		if err != nil || whiteElo < b.options.MinElo {
+			return false
+		}
+		blackElo, err := strconv.Atoi(game.Tags["BlackElo"])
+		if err != nil || blackElo < b.options.MinElo {
+			return false
+		}
+	}
+	return true
+}
+
+// AddGame replays the game up to the maximum ply, and records every move
+// that is played. It returns false if the game is filtered out
+func (b *BookBuilder) AddGame(game *PGNGame) bool {
+	if !b.accepts(game) {
+		return false
+	}
+
+	fen := startFen
+	if setup, ok := game.Tags["FEN"]; ok {
+		fen = setup
+	}
+	replay := FromFen(fen, false)
+	position := replay.Position()
+
+	result := game.Result()
+	for ply, san := range game.Moves {
+		if ply >= b.options.MaxPly {
+			break
+		}
+		move, err := position.ParseSAN(san)
+		if err != nil {
+			break
+		}
+		key := PolyglotHash(position)
+		moves, ok := b.positions[key]
+		if !ok {
+			moves = make(map[uint16]*moveStats, 4)
+			b.positions[key] = moves
+		}
+		encoded := EncodeMove(move)
+		stats, ok := moves[encoded]
+		if !ok {
+			stats = &moveStats{}
+			moves[encoded] = stats
+		}
+		stats.count++
+		switch {
+		case result == "1/2-1/2":
+			stats.draws++
+		case (result == "1-0") == (position.Turn() == White):
+			stats.wins++
+		default:
+			stats.losses++
+		}
+		position.MakeMove(move)
+	}
+	b.games++
+	return true
+}
+
+// AddPGN adds all the games of a PGN collection, and returns the number of
+// games that passed the filters
+func (b *BookBuilder) AddPGN(reader io.Reader) (int, error) {
+	pgnReader := NewPGNReader(reader)
+	added := 0
+	for {
+		game, err := pgnReader.Next()
+		if err == io.EOF {
+			return added, nil
+		} else if err != nil {
+			return added, err
+		}
+		if b.AddGame(game) {
+			added++
+		}
+	}
+}
+
+// Entries returns the book entries sorted by key, and for the same key, by
+// weight. Weights are scaled per position to fit in 16 bits
+func (b *BookBuilder) Entries() []BookEntry {
+	entries := make([]BookEntry, 0, len(b.positions))
+	for key, moves := range b.positions {
+		maxScore := 0
+		for _, stats := range moves {
+			if stats.count >= b.options.MinCount && stats.score() > maxScore {
+				maxScore = stats.score()
+			}
+		}
+		for move, stats := range moves {
+			if stats.count < b.options.MinCount || stats.score() == 0 {
+				continue
+			}
+			weight := stats.score()
+			if maxScore > 0xFFFF {
+				weight = weight * 0xFFFF / maxScore
+			}
+			if weight == 0 {
+				weight = 1
+			}
+			entries = append(entries, BookEntry{key, move, uint16(weight), 0})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Key != entries[j].Key {
+			return entries[i].Key < entries[j].Key
+		}
+		if entries[i].Weight != entries[j].Weight {
+			return entries[i].Weight > entries[j].Weight
+		}
+		return entries[i].Move < entries[j].Move
+	})
+	return entries
+}
+
+func (b *BookBuilder) Write(path string) (int, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	entries := b.Entries()
+	chunk := make([]byte, ENTRY_SIZE)
+	for _, entry := range entries {
+		binary.BigEndian.PutUint64(chunk[0:8], entry.Key)
+		binary.BigEndian.PutUint16(chunk[8:10], entry.Move)
+		binary.BigEndian.PutUint16(chunk[10:12], entry.Weight)
+		binary.BigEndian.PutUint32(chunk[12:16], entry.Learn)
+		if _, err := writer.Write(chunk); err != nil {
+			return 0, err
+		}
+	}
+	return len(entries), writer.Flush()
+}
@@ -0,0 +1,94 @@
+package book
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/amanjpro/zahak/engine"
+)
+
+const collection = `[Result "1-0"]
+[WhiteElo "2400"]
+[BlackElo "2300"]
+
+1. e4 e5 2. Nf3 Nc6 1-0
+
+[Result "1-0"]
+[WhiteElo "2400"]
+[BlackElo "2300"]
+
+1. e4 c5 2. Nf3 1-0
+
+[Result "1/2-1/2"]
+[WhiteElo "2400"]
+[BlackElo "2300"]
+
+1. d4 d5 1/2-1/2
+
+[Result "0-1"]
+[WhiteElo "1200"]
+[BlackElo "2300"]
+
+1. a4 e5 0-1
+
+[Result "*"]
+
+1. g4 *
+`
+
+func TestBookBuilder(t *testing.T) {
+	builder := NewBookBuilder(BuilderOptions{
+		MaxPly:   3,
+		MinElo:   2000,
+		MinCount: 1,
+		Results:  []string{"1-0", "0-1", "1/2-1/2"},
+	})
+	added, err := builder.AddPGN(strings.NewReader(collection))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 3 {
+		t.Errorf("Expected 3 games to pass the filters, got %d", added)
+	}
+
+	dir, err := ioutil.TempDir("", "zahak-book")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "book.bin")
+
+	// The black replies lost, so only e4, Nf3 (after both e5 and c5), d4 and d5 remain
+	written, err := builder.Write(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 5 {
+		t.Errorf("Expected 5 book entries, got %d", written)
+	}
+
+	book, err := LoadBook(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(book.entries); i++ {
+		if book.entries[i-1].Key > book.entries[i].Key {
+			t.Errorf("Book entries are not sorted by key")
+		}
+	}
+
+	game := FromFen(startFen, false)
+	expected := Move{E2, E4, NoType, 0}
+	mv, ok := book.Probe(game.Position(), true)
+	if !ok || mv != expected {
+		t.Errorf("Unexpected book move:%s\n", fmt.Sprintf("Expected: %s\nGot: %s\n", expected.ToString(), mv.ToString()))
+	}
+	entries := book.Entries(PolyglotHash(game.Position()))
+	if len(entries) != 2 || entries[0].Weight != 4 || entries[1].Weight != 1 {
+		t.Errorf("Unexpected weights for the starting position: %v", entries)
+	}
+}
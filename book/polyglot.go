@@ -0,0 +1,122 @@
+package book
+
+import (
+	. "github.com/amanjpro/zahak/engine"
+)
+
+const (
+	castleOffset    = 768
+	enPassantOffset = 772
+	turnOffset      = 780
+)
+
+// Polyglot orders pieces as: bp, wp, bn, wn, bb, wb, br, wr, bq, wq, bk, wk
+func polyglotPieceKind(piece Piece) int {
+	kind := 0
+	switch piece.Type() {
+	case Pawn:
+		kind = 0
+	case Knight:
+		kind = 2
+	case Bishop:
+		kind = 4
+	case Rook:
+		kind = 6
+	case Queen:
+		kind = 8
+	case King:
+		kind = 10
+	}
+	if piece.Color() == White {
+		kind += 1
+	}
+	return kind
+}
+
+func PolyglotHash(position *Position) uint64 {
+	var hash uint64 = 0
+	board := position.Board
+
+	for sq := A1; sq <= H8; sq++ {
+		piece := board.PieceAt(sq)
+		if piece != NoPiece {
+			hash ^= polyglotRandom64[64*polyglotPieceKind(piece)+int(sq)]
+		}
+	}
+
+	if position.HasTag(WhiteCanCastleKingSide) {
+		hash ^= polyglotRandom64[castleOffset]
+	}
+	if position.HasTag(WhiteCanCastleQueenSide) {
+		hash ^= polyglotRandom64[castleOffset+1]
+	}
+	if position.HasTag(BlackCanCastleKingSide) {
+		hash ^= polyglotRandom64[castleOffset+2]
+	}
+	if position.HasTag(BlackCanCastleQueenSide) {
+		hash ^= polyglotRandom64[castleOffset+3]
+	}
+
+	// Polyglot only hashes the en-passant square, if it can actually be captured
+	if position.EnPassant != NoSquare && canCaptureEnPassant(position) {
+		hash ^= polyglotRandom64[enPassantOffset+int(position.EnPassant.File())]
+	}
+
+	if position.Turn() == White {
+		hash ^= polyglotRandom64[turnOffset]
+	}
+	return hash
+}
+
+func canCaptureEnPassant(position *Position) bool {
+	ep := position.EnPassant
+	file := ep.File()
+	var pawns uint64
+	var rank Rank
+	if position.Turn() == White {
+		pawns = position.Board.GetBitboardOf(WhitePawn)
+		rank = Rank5
+	} else {
+		pawns = position.Board.GetBitboardOf(BlackPawn)
+		rank = Rank4
+	}
+	if file != FileA && pawns&(1<<SquareOf(file-1, rank)) != 0 {
+		return true
+	}
+	if file != FileH && pawns&(1<<SquareOf(file+1, rank)) != 0 {
+		return true
+	}
+	return false
+}
+
+// Polyglot moves are encoded as: to (6 bits), from (6 bits) and promotion piece (3 bits).
+// Castling moves are encoded as the king capturing its own rook
+func EncodeMove(move Move) uint16 {
+	destination := move.Destination
+	if move.HasTag(KingSideCastle) {
+		destination = SquareOf(FileH, move.Source.Rank())
+	} else if move.HasTag(QueenSideCastle) {
+		destination = SquareOf(FileA, move.Source.Rank())
+	}
+	promotion := uint16(0)
+	switch move.PromoType {
+	case Knight:
+		promotion = 1
+	case Bishop:
+		promotion = 2
+	case Rook:
+		promotion = 3
+	case Queen:
+		promotion = 4
+	}
+	return uint16(destination) | uint16(move.Source)<<6 | promotion<<12
+}
+
+func DecodeMove(position *Position, encoded uint16) (Move, bool) {
+	for _, move := range position.LegalMoves() {
+		if EncodeMove(move) == encoded {
+			return move, true
+		}
+	}
+	return Move{Source: NoSquare, Destination: NoSquare}, false
+}
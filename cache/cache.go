@@ -1,11 +1,16 @@
 package cache
 
+import (
+	"sync/atomic"
+)
+
 type CachedEval struct {
 	Hash  uint64
 	Eval  int32
 	Depth int8
 	Type  NodeType
 	Age   uint16
+	Move  uint32 // The packed best move, 0 if there is none
 }
 
 type NodeType uint8
@@ -18,18 +23,28 @@ const (
 
 var oldAge = uint16(5)
 
-const CACHE_ENTRY_SIZE = uint32(64 + 16 + 8 + 8 + 32)
+const CACHE_ENTRY_SIZE = uint32(64 + 16 + 8 + 8 + 32 + 32)
+
+// Every entry is stored as three 64-bit words, the packed data, the move and the
+// hash xor-ed with both. The words are read and written atomically, but not together,
+// so when two threads race on the same entry, the hash check fails and the torn entry
+// is simply discarded
+type entry struct {
+	key  uint64
+	data uint64
+	move uint64
+}
 
 type Cache struct {
-	items    []CachedEval
+	items    []entry
 	size     uint32
-	consumed int
+	consumed int64
 }
 
-var EmptyEval = CachedEval{0, 0, 0, 0, 0}
+var EmptyEval = CachedEval{0, 0, 0, 0, 0, 0}
 
 func (c *Cache) Consumed() int {
-	return int((float64(c.consumed) / float64(len(c.items))) * 1000)
+	return int((float64(atomic.LoadInt64(&c.consumed)) / float64(len(c.items))) * 1000)
 }
 
 var EmptyCache = Cache{nil, 0, 0}
@@ -39,16 +54,55 @@ func (c *Cache) hash(key uint64) uint32 {
 	return uint32(key>>32) % c.size
 }
 
+func pack(value CachedEval) uint64 {
+	return uint64(uint32(value.Eval)) |
+		uint64(uint8(value.Depth))<<32 |
+		uint64(value.Type)<<40 |
+		uint64(value.Age)<<48
+}
+
+func unpack(hash uint64, data uint64, move uint64) CachedEval {
+	return CachedEval{
+		hash,
+		int32(uint32(data)),
+		int8(uint8(data >> 32)),
+		NodeType(uint8(data >> 40)),
+		uint16(data >> 48),
+		uint32(move),
+	}
+}
+
+func (c *Cache) load(index uint32) (uint64, uint64, uint64) {
+	item := &c.items[index]
+	data := atomic.LoadUint64(&item.data)
+	move := atomic.LoadUint64(&item.move)
+	key := atomic.LoadUint64(&item.key)
+	return key ^ data ^ move, data, move
+}
+
+func (c *Cache) store(index uint32, value CachedEval) {
+	item := &c.items[index]
+	data := pack(value)
+	move := uint64(value.Move)
+	atomic.StoreUint64(&item.data, data)
+	atomic.StoreUint64(&item.move, move)
+	atomic.StoreUint64(&item.key, value.Hash^data^move)
+}
+
 func (c *Cache) Set(hash uint64, value CachedEval) {
 	key := c.hash(hash)
-	oldValue := c.items[key]
-	if oldValue != EmptyEval {
+	oldHash, oldData, oldMove := c.load(key)
+	if oldData != 0 {
+		oldValue := unpack(oldHash, oldData, oldMove)
 		if value.Hash == oldValue.Hash {
-			c.items[key] = value
+			if value.Move == 0 { // Keep the move of the previous search
+				value.Move = oldValue.Move
+			}
+			c.store(key, value)
 			return
 		}
 		if value.Age-oldValue.Age >= oldAge {
-			c.items[key] = value
+			c.store(key, value)
 			return
 		}
 		if oldValue.Depth > value.Depth {
@@ -57,41 +111,35 @@ func (c *Cache) Set(hash uint64, value CachedEval) {
 		if oldValue.Type == Exact || value.Type != Exact {
 			return
 		} else if value.Type == Exact {
-			c.items[key] = value
+			c.store(key, value)
 			return
 		}
-		c.items[key] = value
+		c.store(key, value)
 	} else {
-		c.consumed += 1
-		c.items[key] = value
+		atomic.AddInt64(&c.consumed, 1)
+		c.store(key, value)
 	}
 }
 
 func (c *Cache) Get(hash uint64) (CachedEval, bool) {
 	key := c.hash(hash)
-	item := c.items[key]
-	if item.Hash == hash {
-		return item, true
+	itemHash, data, move := c.load(key)
+	if itemHash == hash && data != 0 {
+		return unpack(hash, data, move), true
 	}
 	return EmptyEval, false
 }
 
 func NewCache(megabytes uint32) {
 	size := megabytes * 1024 * 1024 / CACHE_ENTRY_SIZE
-	items := make([]CachedEval, size)
-	TranspositionTable = Cache{items, uint32(size), 0} //s, current: 0}
-	for i := 0; i < int(size); i++ {
-		TranspositionTable.items[i] = EmptyEval
-	}
+	items := make([]entry, size)
+	TranspositionTable = Cache{items, uint32(size), 0}
 }
 
 func ResetCache() {
 	if TranspositionTable.size != EmptyCache.size {
-		TranspositionTable.items = make([]CachedEval, TranspositionTable.size)
+		TranspositionTable.items = make([]entry, TranspositionTable.size)
 		TranspositionTable.consumed = 0
-		for i := 0; i < int(TranspositionTable.size); i++ {
-			TranspositionTable.items[i] = EmptyEval
-		}
 	} else {
 		NewCache(400)
 	}
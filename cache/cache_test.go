@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestSetAndGet(t *testing.T) {
+	NewCache(1)
+	hash := uint64(0xDEADBEEF12345678)
+	value := CachedEval{hash, -400_000, -3, LowerBound, 1021, 0x0C061C0B}
+	TranspositionTable.Set(hash, value)
+
+	actual, ok := TranspositionTable.Get(hash)
+	if !ok || actual != value {
+		t.Errorf("Unexpected cached value\nExpected: %v\nGot: %v\n", value, actual)
+	}
+
+	TranspositionTable.Set(hash, CachedEval{hash, 10, 4, Exact, 1021, 0})
+	actual, _ = TranspositionTable.Get(hash)
+	if actual.Move != value.Move {
+		t.Errorf("The move is not kept when the same position is stored without a move")
+	}
+
+	if _, ok := TranspositionTable.Get(hash + 1); ok {
+		t.Errorf("Found a value for a hash that was never cached")
+	}
+}
+
+// Every value is derived from its hash, so a torn entry that slips through
+// the verification would be detected
+func valueOf(hash uint64) CachedEval {
+	return CachedEval{
+		hash,
+		int32(hash),
+		int8(hash >> 32),
+		NodeType(1 << (hash % 3)),
+		uint16(hash >> 48),
+		uint32(hash>>8) | 1,
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	NewCache(1)
+	// Force every hash into a handful of slots, to maximize contention
+	TranspositionTable.size = 8
+
+	var wg sync.WaitGroup
+	errors := make(chan CachedEval, 100)
+	for worker := 0; worker < 16; worker++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for i := 0; i < 20_000; i++ {
+				hash := r.Uint64()
+				TranspositionTable.Set(hash, valueOf(hash))
+				probe := r.Uint64()
+				if r.Intn(2) == 0 {
+					probe = hash
+				}
+				if value, ok := TranspositionTable.Get(probe); ok && value != valueOf(probe) {
+					select {
+					case errors <- value:
+					default:
+					}
+				}
+			}
+		}(int64(worker))
+	}
+	wg.Wait()
+	close(errors)
+
+	for value := range errors {
+		t.Errorf("Got a torn entry: %v, expected: %v", value, valueOf(value.Hash))
+	}
+}
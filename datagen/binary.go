@@ -0,0 +1,195 @@
+package datagen
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	. "github.com/amanjpro/zahak/engine"
+)
+
+// Format is the way the records are written
+type Format int8
+
+const (
+	TextFormat   Format = iota // A line per position, see Generator
+	BinaryFormat               // BINARY_RECORD_SIZE bytes per position, see encodeRecord
+)
+
+const BINARY_RECORD_SIZE = 36
+
+// The scores are clamped to this in the binary format, so that they fit in 16 bits
+const MAX_BINARY_SCORE = int32(32000)
+
+// The pieces of the binary format, 0 is not used
+const binaryPieces = " PNBRQKpnbrqk"
+
+const castlingRights = "KQkq"
+
+// encodeRecord writes the record in BINARY_RECORD_SIZE bytes, little endian:
+//   - the occupied squares of the board, bit 0 is a1 and bit 63 is h8 (8 bytes)
+//   - the pieces of the occupied squares, from a1 to h8, 4 bits each (16 bytes)
+//   - the side to move in bit 0, and KQkq castling rights in bits 1 to 4 (1 byte)
+//   - the file of the en passant square plus one, 0 when there is none (1 byte)
+//   - the half-move clock (1 byte) and the full-move number (2 bytes)
+//   - the score and the static evaluation from white's point of view (2 bytes each)
+//   - the best move, source and destination squares in bits 0-5 and 6-11, and the
+//     promotion piece type plus one in bits 12-14, 0 when it does not promote (2 bytes)
+//   - the result for white in half points, 2 for a win, 1 for a draw and 0 for a loss (1 byte)
+func encodeRecord(record Record, result float64) ([]byte, error) {
+	fields := strings.Fields(record.Fen)
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("unexpected FEN %s", record.Fen)
+	}
+	data := make([]byte, BINARY_RECORD_SIZE)
+
+	var board [64]byte
+	for i, row := range strings.Split(fields[0], "/") {
+		rank, file := 7-i, 0
+		for _, c := range row {
+			if c >= '1' && c <= '8' {
+				file += int(c - '0')
+				continue
+			}
+			piece := strings.IndexRune(binaryPieces, c)
+			if piece <= 0 || file > 7 || rank < 0 {
+				return nil, fmt.Errorf("unexpected FEN %s", record.Fen)
+			}
+			board[rank*8+file] = byte(piece)
+			file++
+		}
+	}
+	var occupancy uint64
+	for i, sq := 0, 0; sq < 64; sq++ {
+		if board[sq] == 0 {
+			continue
+		}
+		occupancy |= 1 << uint(sq)
+		if i >= 32 {
+			return nil, fmt.Errorf("too many pieces in %s", record.Fen)
+		}
+		data[8+i/2] |= board[sq] << uint(4*(i%2))
+		i++
+	}
+	binary.LittleEndian.PutUint64(data[0:], occupancy)
+
+	flags := byte(0)
+	if fields[1] == "b" {
+		flags = 1
+	}
+	for i, c := range castlingRights {
+		if strings.ContainsRune(fields[2], c) {
+			flags |= 1 << uint(i+1)
+		}
+	}
+	data[24] = flags
+	if fields[3] != "-" {
+		data[25] = fields[3][0] - 'a' + 1
+	}
+	halfMoves, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return nil, err
+	}
+	fullMoves, err := strconv.Atoi(fields[5])
+	if err != nil {
+		return nil, err
+	}
+	data[26] = byte(halfMoves)
+	binary.LittleEndian.PutUint16(data[27:], uint16(fullMoves))
+	binary.LittleEndian.PutUint16(data[29:], uint16(int16(clampScore(record.Score))))
+	binary.LittleEndian.PutUint16(data[31:], uint16(int16(clampScore(record.Eval))))
+
+	move := uint16(record.BestMove.Source) | uint16(record.BestMove.Destination)<<6
+	if record.BestMove.PromoType != NoType {
+		move |= uint16(record.BestMove.PromoType+1) << 12
+	}
+	binary.LittleEndian.PutUint16(data[33:], move)
+	data[35] = byte(result * 2)
+	return data, nil
+}
+
+func clampScore(score int32) int32 {
+	if score > MAX_BINARY_SCORE {
+		return MAX_BINARY_SCORE
+	} else if score < -MAX_BINARY_SCORE {
+		return -MAX_BINARY_SCORE
+	}
+	return score
+}
+
+// ReadBinaryRecord reads the next record of a file of the binary format, and the result
+// of its game for white. The best move has no tags, and it returns io.EOF at the end
+func ReadBinaryRecord(reader io.Reader) (Record, float64, error) {
+	data := make([]byte, BINARY_RECORD_SIZE)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return Record{}, 0, err
+	}
+	occupancy := binary.LittleEndian.Uint64(data[0:])
+	var board [64]byte
+	for i, sq := 0, 0; sq < 64; sq++ {
+		if occupancy&(1<<uint(sq)) == 0 {
+			continue
+		}
+		board[sq] = data[8+i/2] >> uint(4*(i%2)) & 0xf
+		i++
+	}
+
+	var fen strings.Builder
+	for rank := 7; rank >= 0; rank-- {
+		empty := 0
+		for file := 0; file < 8; file++ {
+			piece := board[rank*8+file]
+			if piece == 0 {
+				empty++
+				continue
+			}
+			if empty != 0 {
+				fen.WriteString(strconv.Itoa(empty))
+				empty = 0
+			}
+			fen.WriteByte(binaryPieces[piece])
+		}
+		if empty != 0 {
+			fen.WriteString(strconv.Itoa(empty))
+		}
+		if rank != 0 {
+			fen.WriteByte('/')
+		}
+	}
+
+	flags := data[24]
+	if flags&1 == 0 {
+		fen.WriteString(" w ")
+	} else {
+		fen.WriteString(" b ")
+	}
+	castling := ""
+	for i, c := range castlingRights {
+		if flags&(1<<uint(i+1)) != 0 {
+			castling += string(c)
+		}
+	}
+	if castling == "" {
+		castling = "-"
+	}
+	fen.WriteString(castling)
+	if data[25] == 0 {
+		fen.WriteString(" -")
+	} else if flags&1 == 0 { // White captures en passant on the sixth rank
+		fen.WriteString(fmt.Sprintf(" %c6", 'a'+data[25]-1))
+	} else {
+		fen.WriteString(fmt.Sprintf(" %c3", 'a'+data[25]-1))
+	}
+	fen.WriteString(fmt.Sprintf(" %d %d", data[26], binary.LittleEndian.Uint16(data[27:])))
+
+	packed := binary.LittleEndian.Uint16(data[33:])
+	move := Move{Square(packed & 63), Square(packed >> 6 & 63), NoType, 0}
+	if promo := packed >> 12 & 7; promo != 0 {
+		move.PromoType = PieceType(promo - 1)
+	}
+	record := Record{fen.String(), int32(int16(binary.LittleEndian.Uint16(data[29:]))),
+		int32(int16(binary.LittleEndian.Uint16(data[31:]))), move}
+	return record, float64(data[35]) / 2, nil
+}
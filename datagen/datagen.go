@@ -0,0 +1,241 @@
+package datagen
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+
+	. "github.com/amanjpro/zahak/book"
+	. "github.com/amanjpro/zahak/engine"
+	. "github.com/amanjpro/zahak/evaluation"
+	. "github.com/amanjpro/zahak/search"
+)
+
+const startFen = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// A game is adjudicated as a win when the score stays above this for WIN_ADJUDICATION_PLIES
+const WIN_ADJUDICATION_SCORE = int32(1500)
+const WIN_ADJUDICATION_PLIES = 6
+
+type Options struct {
+	Games       int   // The number of games to play
+	Threads     int   // The number of games that are played concurrently
+	Depth       int8  // The depth of the search of every move, 0 for no limit
+	Nodes       int64 // The nodes of the search of every move, 0 for no limit
+	RandomPlies int   // The number of random moves the games start with, after the book
+	MaxPlies    int   // Games that last longer are drawn
+	Book        *Book // The games start with the moves of the book, when it is not nil
+	Seed        int64
+	Format      Format
+	// OnGame is called after every game, with the number of games and positions so far
+	OnGame func(games int, positions int)
+}
+
+// Record is a position of a game, the scores are from white's point of view
+type Record struct {
+	Fen      string
+	Score    int32 // The score of the search
+	Eval     int32 // The static evaluation
+	BestMove Move
+}
+
+// Generator plays self-play games, and writes their quiet positions labelled with the
+// result of the game as lines of: FEN [result] score eval bestmove, where the result is
+// 1.0, 0.5 or 0.0 from white's point of view. The lines can be tuned on with -tune.
+// With BinaryFormat the positions are written as records of BINARY_RECORD_SIZE bytes.
+//
+// Every thread has its own engine, but the games share the transposition table, like the
+// threads of a Lazy SMP search do. The entries are checked against the whole hash, so a
+// game only finds the entries of the positions it reaches too, and their scores hold for
+// it as well; a table per game would multiply the memory by the threads. With one thread
+// the data only depends on the seed, with more the games also race for the table
+type Generator struct {
+	options   Options
+	writer    *bufio.Writer
+	lock      sync.Mutex
+	next      int
+	games     int
+	positions int
+	err       error
+}
+
+func NewGenerator(options Options, writer io.Writer) *Generator {
+	if options.Threads < 1 {
+		options.Threads = 1
+	}
+	if options.Depth <= 0 && options.Nodes <= 0 {
+		options.Depth = 8
+	}
+	if options.MaxPlies <= 0 {
+		options.MaxPlies = 400
+	}
+	return &Generator{options: options, writer: bufio.NewWriter(writer)}
+}
+
+// Run plays the games on the threads, and returns the number of games and positions
+// that are written
+func (g *Generator) Run(ctx context.Context) (int, int, error) {
+	FromFen(startFen, true) // Initializes the hash keys, before the threads use them
+	var wg sync.WaitGroup
+	for thread := 0; thread < g.options.Threads; thread++ {
+		wg.Add(1)
+		go func(thread int) {
+			defer wg.Done()
+			random := rand.New(rand.NewSource(g.options.Seed + int64(thread)))
+			e := NewEngine()
+			for g.takeGame() && ctx.Err() == nil {
+				records, result := g.play(ctx, e, random)
+				if ctx.Err() != nil {
+					return
+				}
+				g.write(records, result)
+			}
+		}(thread)
+	}
+	wg.Wait()
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if err := g.writer.Flush(); err != nil && g.err == nil {
+		g.err = err
+	}
+	return g.games, g.positions, g.err
+}
+
+func (g *Generator) takeGame() bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.next >= g.options.Games || g.err != nil {
+		return false
+	}
+	g.next++
+	return true
+}
+
+func (g *Generator) write(records []Record, result float64) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for _, record := range records {
+		var err error
+		if g.options.Format == BinaryFormat {
+			var data []byte
+			if data, err = encodeRecord(record, result); err == nil {
+				_, err = g.writer.Write(data)
+			}
+		} else {
+			_, err = fmt.Fprintf(g.writer, "%s [%.1f] %d %d %s\n", record.Fen, result,
+				record.Score, record.Eval, record.BestMove.ToString())
+		}
+		if err != nil {
+			g.err = err
+			return
+		}
+	}
+	g.games++
+	g.positions += len(records)
+	if g.options.OnGame != nil {
+		g.options.OnGame(g.games, g.positions)
+	}
+}
+
+// opening plays the book moves, and then the random moves, and returns the number of
+// plies played. It returns false when the game ends before the opening does
+func (g *Generator) opening(game *Game, random *rand.Rand) (int, bool) {
+	position := game.Position()
+	plies := 0
+	if g.options.Book != nil {
+		for {
+			move, ok := g.options.Book.ProbeRandom(position, random)
+			if !ok {
+				break
+			}
+			game.Move(move)
+			plies++
+		}
+	}
+	for i := 0; i < g.options.RandomPlies; i++ {
+		moves := position.LegalMoves()
+		if len(moves) == 0 {
+			return plies, false
+		}
+		game.Move(moves[random.Intn(len(moves))])
+		plies++
+	}
+	return plies, game.Status() == Unknown
+}
+
+// play plays a game, and returns its quiet positions and its result for white
+func (g *Generator) play(ctx context.Context, e *Engine, random *rand.Rand) ([]Record, float64) {
+	var game Game
+	var ply int
+	for {
+		game = FromFen(startFen, false)
+		var ok bool
+		if ply, ok = g.opening(&game, random); ok {
+			break
+		}
+	}
+	position := game.Position()
+
+	var records []Record
+	winningPlies := 0
+	for ; ply < g.options.MaxPlies && ctx.Err() == nil; ply++ {
+		turn := position.Turn()
+		switch game.Status() {
+		case Checkmate:
+			return records, winnerResult(turn.Other())
+		case Draw:
+			return records, 0.5
+		}
+
+		result := e.Search(ctx, position, Limits{Depth: g.options.Depth, Nodes: g.options.Nodes, Ply: uint16(ply)})
+		if result.BestMove == EmptyMove {
+			break
+		}
+		score := result.Score
+		if score == CHECKMATE_EVAL || score == -CHECKMATE_EVAL {
+			return records, winnerResult(winner(turn, score))
+		}
+		if score >= WIN_ADJUDICATION_SCORE || score <= -WIN_ADJUDICATION_SCORE {
+			winningPlies++
+			if winningPlies >= WIN_ADJUDICATION_PLIES {
+				return records, winnerResult(winner(turn, score))
+			}
+		} else {
+			winningPlies = 0
+		}
+
+		if isQuiet(position, result.BestMove) {
+			eval := Evaluate(position)
+			if turn == Black {
+				score, eval = -score, -eval
+			}
+			records = append(records, Record{fmt.Sprintf("%s %d", position.Fen(), ply/2+1), score, eval, result.BestMove})
+		}
+		game.Move(result.BestMove)
+	}
+	return records, 0.5
+}
+
+// Positions in check, and positions where the best move captures or promotes, are
+// not quiet, the static evaluation is meaningless in them
+func isQuiet(position *Position, best Move) bool {
+	return !position.IsInCheck() && !best.HasTag(Capture) && !best.HasTag(EnPassant) && best.PromoType == NoType
+}
+
+func winner(turn Color, score int32) Color {
+	if score > 0 {
+		return turn
+	}
+	return turn.Other()
+}
+
+func winnerResult(color Color) float64 {
+	if color == White {
+		return 1
+	}
+	return 0
+}
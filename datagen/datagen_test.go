@@ -0,0 +1,163 @@
+package datagen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/amanjpro/zahak/book"
+	. "github.com/amanjpro/zahak/engine"
+	. "github.com/amanjpro/zahak/tuning"
+)
+
+func TestGeneratorWritesQuietPositionsWithResults(t *testing.T) {
+	var buffer bytes.Buffer
+	games := 0
+	generator := NewGenerator(Options{
+		Games:       3,
+		Threads:     2,
+		Depth:       2,
+		RandomPlies: 8,
+		MaxPlies:    60,
+		Seed:        7,
+		OnGame: func(played int, positions int) {
+			games = played
+		},
+	}, &buffer)
+	played, positions, err := generator.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if played != 3 || games != 3 {
+		t.Errorf("Expected 3 games, got %d (%d reported)", played, games)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if positions == 0 || len(lines) != positions {
+		t.Fatalf("Expected %d lines, got %d", positions, len(lines))
+	}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 10 {
+			t.Fatalf("Unexpected line %s", line)
+		}
+		result := fields[6]
+		if result != "[1.0]" && result != "[0.5]" && result != "[0.0]" {
+			t.Errorf("Unexpected result in %s", line)
+		}
+		position := PositionFromFen(strings.Join(fields[:6], " "))
+		if position.IsInCheck() {
+			t.Errorf("Positions in check should be filtered out: %s", line)
+		}
+		legal := false
+		for _, move := range position.LegalMoves() {
+			if move.ToString() == fields[9] {
+				legal = move.PromoType == NoType && !move.HasTag(Capture)
+			}
+		}
+		if !legal {
+			t.Errorf("Expected the best move to be a legal quiet move: %s", line)
+		}
+	}
+
+	// The data can be tuned on
+	dataset, err := ReadDataset(&buffer)
+	if err != nil || dataset.Len() == 0 {
+		t.Errorf("Expected the tuner to read the data, got %d positions and %v", dataset.Len(), err)
+	}
+}
+
+func TestGeneratorIsReproducibleWithABook(t *testing.T) {
+	builder := NewBookBuilder(BuilderOptions{MaxPly: 2, MinCount: 1, Results: []string{"1-0", "0-1", "1/2-1/2"}})
+	pgn := ""
+	for _, moves := range []string{"e4 e5", "e4 c5", "d4 d5", "d4 Nf6", "c4 e5", "Nf3 d5"} {
+		pgn += "[Result \"1/2-1/2\"]\n\n1. " + moves + " 1/2-1/2\n\n"
+	}
+	if _, err := builder.AddPGN(strings.NewReader(pgn)); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "zahak-datagen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "book.bin")
+	if _, err := builder.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	book, err := LoadBook(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generate := func() string {
+		var buffer bytes.Buffer
+		generator := NewGenerator(Options{Games: 4, Threads: 1, Depth: 2, RandomPlies: 2, MaxPlies: 30, Book: book, Seed: 11}, &buffer)
+		if _, _, err := generator.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return buffer.String()
+	}
+	if first, second := generate(), generate(); first != second {
+		t.Errorf("Expected the same seed to generate the same data:\n%s\n%s", first, second)
+	}
+}
+
+func TestBinaryFormatHasTheSamePositionsAsTheText(t *testing.T) {
+	generate := func(format Format) []byte {
+		var buffer bytes.Buffer
+		generator := NewGenerator(Options{Games: 2, Threads: 1, Depth: 2, RandomPlies: 6, MaxPlies: 40, Seed: 3, Format: format}, &buffer)
+		if _, _, err := generator.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return buffer.Bytes()
+	}
+	lines := strings.Split(strings.TrimSpace(string(generate(TextFormat))), "\n")
+	data := generate(BinaryFormat)
+	if len(data) != len(lines)*BINARY_RECORD_SIZE {
+		t.Fatalf("Expected %d records, got %d bytes", len(lines), len(data))
+	}
+
+	reader := bytes.NewReader(data)
+	for _, line := range lines {
+		record, result, err := ReadBinaryRecord(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded := fmt.Sprintf("%s [%.1f] %d %d %s", record.Fen, result, record.Score, record.Eval,
+			record.BestMove.ToString()); decoded != line {
+			t.Errorf("Expected %s, got %s", line, decoded)
+		}
+	}
+	if _, _, err := ReadBinaryRecord(reader); err != io.EOF {
+		t.Errorf("Expected the end of the data, got: %v", err)
+	}
+}
+
+func TestBinaryFormatKeepsCastlingEnPassantAndPromotions(t *testing.T) {
+	for _, fen := range []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w Kq - 3 17",
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+		"8/8/8/2k5/2pP4/8/B7/4K3 b - d3 0 3",
+	} {
+		record := Record{fen, 40000, -35, Move{G7, H8, Knight, 0}}
+		data, err := encodeRecord(record, 0.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, result, err := ReadBinaryRecord(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := Record{fen, MAX_BINARY_SCORE, -35, Move{G7, H8, Knight, 0}}
+		if decoded != expected || result != 0.5 {
+			t.Errorf("Expected %v and 0.5, got %v and %f", expected, decoded, result)
+		}
+	}
+}
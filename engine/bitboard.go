@@ -322,6 +322,29 @@ func (b *Bitboard) IsEndGame() bool {
 	return false
 }
 
+// HasNonPawnMaterial checks whether the side has any piece other than the king and pawns
+func (b *Bitboard) HasNonPawnMaterial(color Color) bool {
+	if color == White {
+		return b.whiteKnight|b.whiteBishop|b.whiteRook|b.whiteQueen != 0
+	}
+	return b.blackKnight|b.blackBishop|b.blackRook|b.blackQueen != 0
+}
+
+// The phase of the starting position, minor pieces count 1, rooks 2 and queens 4
+const MAX_PHASE = int32(24)
+
+// Phase is MAX_PHASE for the opening material, going down to 0 when only kings and pawns remain
+func (b *Bitboard) Phase() int32 {
+	minors := bits.OnesCount64(b.whiteKnight | b.blackKnight | b.whiteBishop | b.blackBishop)
+	rooks := bits.OnesCount64(b.whiteRook | b.blackRook)
+	queens := bits.OnesCount64(b.whiteQueen | b.blackQueen)
+	phase := int32(minors + 2*rooks + 4*queens)
+	if phase > MAX_PHASE { // promotions
+		return MAX_PHASE
+	}
+	return phase
+}
+
 // Draw returns visual representation of the board useful for debugging.
 func (b *Bitboard) Draw() string {
 	pieceUnicodes := []string{"♔", "♕", "♖", "♗", "♘", "♙", "♚", "♛", "♜", "♝", "♞", "♟"}
@@ -41,6 +41,40 @@ func (b *Bitboard) getLeastValuablePiece(attacks uint64, color Color) (uint64, P
 }
 
 func (b *Bitboard) StaticExchangeEval(toSq Square, target Piece, frSq Square, aPiece Piece) int32 {
+	return b.staticExchange(toSq, target.Weight(), frSq, aPiece)
+}
+
+// SeeAtLeast checks whether the static exchange of the move, quiet or capture, gains
+// at least threshold. For promotions the pawn is swapped with the promoted piece
+func (p *Position) SeeAtLeast(move Move, threshold int32) bool {
+	board := p.Board
+	piece := board.PieceAt(move.Source)
+	gain := int32(0)
+	if move.HasTag(EnPassant) {
+		pawn := WhitePawn
+		gain = pawn.Weight()
+	} else if captured := board.PieceAt(move.Destination); captured != NoPiece {
+		gain = captured.Weight()
+	}
+	if piece.Type() == King { // The king never moves to an attacked square
+		return gain >= threshold
+	}
+	if move.PromoType != NoType {
+		promoPiece := GetPiece(move.PromoType, piece.Color())
+		gain += promoPiece.Weight() - piece.Weight()
+		piece = promoPiece
+	}
+	// Nothing to lose, or even losing the piece is good enough
+	if gain < threshold {
+		return false
+	}
+	if gain-piece.Weight() >= threshold {
+		return true
+	}
+	return board.staticExchange(move.Destination, gain, move.Source, piece) >= threshold
+}
+
+func (b *Bitboard) staticExchange(toSq Square, initialGain int32, frSq Square, aPiece Piece) int32 {
 
 	gain := make([]int32, 32)
 	d := 0
@@ -58,7 +92,7 @@ func (b *Bitboard) StaticExchangeEval(toSq Square, target Piece, frSq Square, aP
 	rooksQueens |= b.blackRook | b.whiteRook
 	bishopsQueens |= b.blackBishop | b.whiteBishop
 
-	gain[d] = target.Weight()
+	gain[d] = initialGain
 
 	for fromSet != 0 {
 		d++ // next depth and side
@@ -67,7 +101,7 @@ func (b *Bitboard) StaticExchangeEval(toSq Square, target Piece, frSq Square, aP
 		if max(-gain[d-1], gain[d]) < 0 {
 			break // pruning does not influence the result
 		}
-		attacks ^= fromSet  // reset bit in set to traverse
+		attacks &^= fromSet // reset bit in set to traverse, pushed pawns are not attackers
 		occupied ^= fromSet // reset bit in temporary occupancy (for x-Rays)
 		if fromSet&mayXray != 0 {
 			bishopsQueens &^= fromSet // reset bit in temporary occupancy for bishops/queens
@@ -109,6 +143,33 @@ func (b *Bitboard) AllAttacks(color Color) uint64 {
 	return tabooSquares(*b, color)
 }
 
+// KingZone is the squares around the king, and the squares in front of them
+func KingZone(sq Square, color Color) uint64 {
+	zone := computedKingAttacks[sq] | (1 << sq)
+	if color == White {
+		return zone | nortOne(zone)
+	}
+	return zone | soutOne(zone)
+}
+
+// The attacks of a single piece, including the squares of the pieces it defends
+
+func KnightAttacksFrom(sq Square) uint64 {
+	return computedKnightAttacks[sq]
+}
+
+func BishopAttacksFrom(sq Square, occupied uint64) uint64 {
+	return bishopAttacks(sq, occupied, empty)
+}
+
+func RookAttacksFrom(sq Square, occupied uint64) uint64 {
+	return rookAttacks(sq, occupied, empty)
+}
+
+func QueenAttacksFrom(sq Square, occupied uint64) uint64 {
+	return queenAttacks(sq, occupied, empty)
+}
+
 func max(x int32, y int32) int32 {
 	if x > y {
 		return x
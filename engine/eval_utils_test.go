@@ -55,3 +55,24 @@ func TestSlidingPiecesStaticExchangeEvalPositive(t *testing.T) {
 		t.Error(fmt.Sprintf("Expected: %d\n, Got: %d\n", expected, actual))
 	}
 }
+
+func TestSeeAtLeast(t *testing.T) {
+	fen := "4k3/8/2p5/3p4/8/8/8/3QK3 w - - 0 1"
+	game := FromFen(fen, true)
+	position := game.position
+
+	capture := Move{D1, D5, NoType, Capture}
+	if !position.SeeAtLeast(capture, -800) || position.SeeAtLeast(capture, -799) {
+		t.Error("Expected the capture to lose exactly 800")
+	}
+
+	quiet := Move{D1, D4, NoType, 0}
+	if !position.SeeAtLeast(quiet, 0) {
+		t.Error("Expected the queen to be safe on d4")
+	}
+
+	hanging := Move{D1, C4, NoType, 0}
+	if position.SeeAtLeast(hanging, -899) {
+		t.Error("Expected the queen to hang on c4")
+	}
+}
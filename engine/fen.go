@@ -107,7 +107,8 @@ func bitboardFromFen(fen string) Bitboard {
 	return board
 }
 
-func positionFromFen(fen string) Position {
+// positionFromFen parses the position, with room for the given number of positions in its history
+func positionFromFen(fen string, history int) Position {
 	parts := strings.Fields(fen)
 	if len(parts) != 6 {
 		panic(fmt.Sprintf("Invalid FEN notation %s, there should be 6 parts", fen))
@@ -121,8 +122,9 @@ func positionFromFen(fen string) Position {
 		NoSquare,
 		0,
 		0,
-		*intintmap.New(10000, 0.5),
+		*intintmap.New(history, 0.5),
 		uint8(halfMoveClock),
+		nil,
 	}
 
 	if parts[1] == "b" {
@@ -163,12 +165,19 @@ func positionFromFen(fen string) Position {
 	return p
 }
 
+// PositionFromFen parses a position with room for a short history only, it is much
+// cheaper than FromFen for tools that go through many positions
+func PositionFromFen(fen string) *Position {
+	p := positionFromFen(fen, 64)
+	return &p
+}
+
 func FromFen(fen string, clearCache bool) Game {
 	parts := strings.Fields(fen)
 	if len(parts) != 6 {
 		panic(fmt.Sprintf("Invalid FEN notation %s, there should be 6 parts", fen))
 	}
-	p := positionFromFen(fen)
+	p := positionFromFen(fen, 10000)
 
 	moveCount, err := strconv.Atoi(parts[5])
 	if err != nil {
@@ -40,3 +40,20 @@ func (m *Move) ToString() string {
 	}
 	return notation
 }
+
+// Pack encodes the move in 32 bits, no valid move is packed as 0
+func (m *Move) Pack() uint32 {
+	return uint32(uint8(m.Source)) |
+		uint32(uint8(m.Destination))<<8 |
+		uint32(m.PromoType)<<16 |
+		uint32(m.Tag)<<24
+}
+
+func UnpackMove(packed uint32) Move {
+	return Move{
+		Square(int8(uint8(packed))),
+		Square(int8(uint8(packed >> 8))),
+		PieceType(uint8(packed >> 16)),
+		MoveTag(uint8(packed >> 24)),
+	}
+}
@@ -48,7 +48,25 @@ func (p *Position) addCaptureMoves(allMoves *[]Move, withChecks bool, isChecked
 func (p *Position) LegalMoves() []Move {
 	allMoves := make([]Move, 0, 350)
 
-	p.generateMoves(&allMoves, false, false, false)
+	p.generateMoves(&allMoves, false, false, false, false)
+
+	return allMoves
+}
+
+// CaptureMoves generates the legal captures only, including en passant and capturing promotions
+func (p *Position) CaptureMoves() []Move {
+	allMoves := make([]Move, 0, 50)
+
+	p.generateMoves(&allMoves, true, false, false, false)
+
+	return allMoves
+}
+
+// QuietMoves generates the legal moves that do not capture, including castling and promotions
+func (p *Position) QuietMoves() []Move {
+	allMoves := make([]Move, 0, 300)
+
+	p.generateMoves(&allMoves, false, true, false, false)
 
 	return allMoves
 }
@@ -59,12 +77,113 @@ func (p *Position) QuiesceneMoves(withChecks bool) []Move {
 	color := p.Turn()
 	isChecked := isInCheck(p.Board, color)
 
-	p.generateMoves(&allMoves, !(withChecks || isChecked), isChecked, true)
+	p.generateMoves(&allMoves, !(withChecks || isChecked), false, isChecked, true)
 
 	return allMoves
 }
 
-func (p *Position) generateMoves(allMoves *[]Move, capturesOnly bool, positionIsInCheck bool, isQuiescence bool) {
+// QuietChecks generates the legal non-capturing moves that give check, without generating
+// all the quiet moves. Only the moves to the squares that attack the other king and the
+// moves of the pieces that may discover a check are tried. Promotions and castling are
+// not included
+func (p *Position) QuietChecks() []Move {
+	allMoves := make([]Move, 0, 16)
+
+	color := p.Turn()
+	board := p.Board
+	ownPieces, otherPieces, otherKing := board.whitePieces, board.blackPieces, board.blackKing
+	pawns, knights, bishops, rooks, queens, king := board.whitePawn, board.whiteKnight,
+		board.whiteBishop, board.whiteRook, board.whiteQueen, board.whiteKing
+	if color == Black {
+		ownPieces, otherPieces, otherKing = board.blackPieces, board.whitePieces, board.whiteKing
+		pawns, knights, bishops, rooks, queens, king = board.blackPawn, board.blackKnight,
+			board.blackBishop, board.blackRook, board.blackQueen, board.blackKing
+	}
+	occupied := ownPieces | otherPieces
+	kingSq := Square(bitScanForward(otherKing))
+
+	bishopChecks := bishopAttacks(kingSq, occupied, empty) &^ occupied
+	rookChecks := rookAttacks(kingSq, occupied, empty) &^ occupied
+	knightChecks := computedKnightAttacks[kingSq]
+	pawnChecks := bPawnAnyAttacks(otherKing)
+	if color == Black {
+		pawnChecks = wPawnAnyAttacks(otherKing)
+	}
+
+	// Own pieces that stand between a slider and the other king
+	discoverers := uint64(0)
+	blockers := (bishopAttacks(kingSq, occupied, empty) | rookAttacks(kingSq, occupied, empty)) & ownPieces
+	for blockers != 0 {
+		sq := bitScanForward(blockers)
+		without := occupied &^ (1 << sq)
+		if bishopAttacks(kingSq, without, empty)&(bishops|queens) != 0 ||
+			rookAttacks(kingSq, without, empty)&(rooks|queens) != 0 {
+			discoverers |= 1 << sq
+		}
+		blockers ^= (1 << sq)
+	}
+
+	checkTargets := func(sq uint8, checks uint64) uint64 {
+		if discoverers&(1<<sq) != 0 {
+			return universal
+		}
+		return checks
+	}
+
+	for pawns != 0 {
+		src := bitScanForward(pawns)
+		pawn := uint64(1 << src)
+		var pushes uint64
+		if color == White {
+			pushes = wSinglePushTargets(pawn, ^occupied) | wDblPushTargets(pawn, ^occupied)
+		} else {
+			pushes = bSinglePushTargets(pawn, ^occupied) | bDoublePushTargets(pawn, ^occupied)
+		}
+		p.addQuietChecks(&allMoves, Square(src), pushes&^rank1And8&checkTargets(src, pawnChecks))
+		pawns ^= pawn
+	}
+	for knights != 0 {
+		src := bitScanForward(knights)
+		p.addQuietChecks(&allMoves, Square(src), knightMovesNoCaptures(Square(src), occupied)&checkTargets(src, knightChecks))
+		knights ^= (1 << src)
+	}
+	for bishops != 0 {
+		src := bitScanForward(bishops)
+		moves := bishopAttacks(Square(src), occupied, ownPieces) &^ otherPieces
+		p.addQuietChecks(&allMoves, Square(src), moves&checkTargets(src, bishopChecks))
+		bishops ^= (1 << src)
+	}
+	for rooks != 0 {
+		src := bitScanForward(rooks)
+		moves := rookAttacks(Square(src), occupied, ownPieces) &^ otherPieces
+		p.addQuietChecks(&allMoves, Square(src), moves&checkTargets(src, rookChecks))
+		rooks ^= (1 << src)
+	}
+	for queens != 0 {
+		src := bitScanForward(queens)
+		moves := queenAttacks(Square(src), occupied, ownPieces) &^ otherPieces
+		p.addQuietChecks(&allMoves, Square(src), moves&checkTargets(src, bishopChecks|rookChecks))
+		queens ^= (1 << src)
+	}
+	if king&discoverers != 0 { // The king can only discover checks
+		src := bitScanForward(king)
+		moves := kingMovesNoCaptures(Square(src), occupied, tabooSquares(board, color))
+		p.addQuietChecks(&allMoves, Square(src), moves)
+	}
+
+	return allMoves
+}
+
+// addQuietChecks adds the legal moves from src to the targets that give check
+func (p *Position) addQuietChecks(allMoves *[]Move, src Square, targets uint64) {
+	for targets != 0 {
+		sq := bitScanForward(targets)
+		p.addCaptureMoves(allMoves, true, false, Move{src, Square(sq), NoType, 0})
+		targets ^= (1 << sq)
+	}
+}
+
+func (p *Position) generateMoves(allMoves *[]Move, capturesOnly bool, quietsOnly bool, positionIsInCheck bool, isQuiescence bool) {
 
 	color := p.Turn()
 	board := p.Board
@@ -75,39 +194,39 @@ func (p *Position) generateMoves(allMoves *[]Move, capturesOnly bool, positionIs
 	if isDoubleCheck(board, color) {
 		if color == White {
 			p.bbKingMoves(board.whiteKing, board.whitePieces, board.blackPieces, board.blackKing,
-				taboo, color, p.HasTag(WhiteCanCastleKingSide), p.HasTag(WhiteCanCastleQueenSide), capturesOnly, positionIsInCheck, false, isQuiescence, allMoves)
+				taboo, color, p.HasTag(WhiteCanCastleKingSide), p.HasTag(WhiteCanCastleQueenSide), capturesOnly, quietsOnly, positionIsInCheck, false, isQuiescence, allMoves)
 		} else if color == Black {
 			p.bbKingMoves(board.blackKing, board.blackPieces, board.whitePieces, board.whiteKing,
-				taboo, color, p.HasTag(BlackCanCastleKingSide), p.HasTag(BlackCanCastleQueenSide), capturesOnly, positionIsInCheck, false, isQuiescence, allMoves)
+				taboo, color, p.HasTag(BlackCanCastleKingSide), p.HasTag(BlackCanCastleQueenSide), capturesOnly, quietsOnly, positionIsInCheck, false, isQuiescence, allMoves)
 		}
 	} else {
 
 		if color == White {
 			p.bbPawnMoves(board.whitePawn, board.whitePieces, board.blackPieces,
-				color, p.EnPassant, capturesOnly, positionIsInCheck, false, isQuiescence, allMoves)
+				color, p.EnPassant, capturesOnly, quietsOnly, positionIsInCheck, false, isQuiescence, allMoves)
 			p.bbKnightMoves(board.whiteKnight, board.whitePieces, board.blackPieces,
-				capturesOnly, positionIsInCheck, false, isQuiescence, allMoves)
+				capturesOnly, quietsOnly, positionIsInCheck, false, isQuiescence, allMoves)
 			p.bbSlidingMoves(board.whiteBishop, board.whitePieces, board.blackPieces,
-				color, bishopAttacks, capturesOnly, positionIsInCheck, false, isQuiescence, allMoves)
+				color, bishopAttacks, capturesOnly, quietsOnly, positionIsInCheck, false, isQuiescence, allMoves)
 			p.bbSlidingMoves(board.whiteRook, board.whitePieces, board.blackPieces,
-				color, rookAttacks, capturesOnly, positionIsInCheck, false, isQuiescence, allMoves)
+				color, rookAttacks, capturesOnly, quietsOnly, positionIsInCheck, false, isQuiescence, allMoves)
 			p.bbSlidingMoves(board.whiteQueen, board.whitePieces, board.blackPieces,
-				color, queenAttacks, capturesOnly, positionIsInCheck, false, isQuiescence, allMoves)
+				color, queenAttacks, capturesOnly, quietsOnly, positionIsInCheck, false, isQuiescence, allMoves)
 			p.bbKingMoves(board.whiteKing, board.whitePieces, board.blackPieces, board.blackKing,
-				taboo, color, p.HasTag(WhiteCanCastleKingSide), p.HasTag(WhiteCanCastleQueenSide), capturesOnly, positionIsInCheck, false, isQuiescence, allMoves)
+				taboo, color, p.HasTag(WhiteCanCastleKingSide), p.HasTag(WhiteCanCastleQueenSide), capturesOnly, quietsOnly, positionIsInCheck, false, isQuiescence, allMoves)
 		} else if color == Black {
 			p.bbPawnMoves(board.blackPawn, board.blackPieces, board.whitePieces,
-				color, p.EnPassant, capturesOnly, positionIsInCheck, false, isQuiescence, allMoves)
+				color, p.EnPassant, capturesOnly, quietsOnly, positionIsInCheck, false, isQuiescence, allMoves)
 			p.bbKnightMoves(board.blackKnight, board.blackPieces, board.whitePieces,
-				capturesOnly, positionIsInCheck, false, isQuiescence, allMoves)
+				capturesOnly, quietsOnly, positionIsInCheck, false, isQuiescence, allMoves)
 			p.bbSlidingMoves(board.blackBishop, board.blackPieces, board.whitePieces,
-				color, bishopAttacks, capturesOnly, positionIsInCheck, false, isQuiescence, allMoves)
+				color, bishopAttacks, capturesOnly, quietsOnly, positionIsInCheck, false, isQuiescence, allMoves)
 			p.bbSlidingMoves(board.blackRook, board.blackPieces, board.whitePieces,
-				color, rookAttacks, capturesOnly, positionIsInCheck, false, isQuiescence, allMoves)
+				color, rookAttacks, capturesOnly, quietsOnly, positionIsInCheck, false, isQuiescence, allMoves)
 			p.bbSlidingMoves(board.blackQueen, board.blackPieces, board.whitePieces,
-				color, queenAttacks, capturesOnly, positionIsInCheck, false, isQuiescence, allMoves)
+				color, queenAttacks, capturesOnly, quietsOnly, positionIsInCheck, false, isQuiescence, allMoves)
 			p.bbKingMoves(board.blackKing, board.blackPieces, board.whitePieces, board.whiteKing,
-				taboo, color, p.HasTag(BlackCanCastleKingSide), p.HasTag(BlackCanCastleQueenSide), capturesOnly, positionIsInCheck, false, isQuiescence, allMoves)
+				taboo, color, p.HasTag(BlackCanCastleKingSide), p.HasTag(BlackCanCastleQueenSide), capturesOnly, quietsOnly, positionIsInCheck, false, isQuiescence, allMoves)
 		}
 	}
 }
@@ -129,6 +248,112 @@ func (p *Position) checkMove(m Move) bool {
 	}
 }
 
+// ValidateMove checks whether a move that is not generated in this position (say
+// a hash move or a killer) is legal, without generating all the moves. The check
+// tag of the returned move is recomputed for this position
+func (p *Position) ValidateMove(m Move) (Move, bool) {
+	if m.Source == NoSquare || m.Destination == NoSquare || m.Source == m.Destination {
+		return m, false
+	}
+	color := p.Turn()
+	board := p.Board
+	piece := board.PieceAt(m.Source)
+	if piece == NoPiece || piece.Color() != color {
+		return m, false
+	}
+
+	ownPieces := board.whitePieces
+	otherPieces := board.blackPieces
+	if color == Black {
+		ownPieces, otherPieces = otherPieces, ownPieces
+	}
+	occupied := ownPieces | otherPieces
+	src := uint64(1 << m.Source)
+	dest := uint64(1 << m.Destination)
+	if ownPieces&dest != 0 {
+		return m, false
+	}
+
+	isCapture := otherPieces&dest != 0
+	if m.HasTag(EnPassant) {
+		isCapture = piece.Type() == Pawn && m.Destination == p.EnPassant
+	}
+	if isCapture != m.HasTag(Capture) {
+		return m, false
+	}
+
+	isLastRank := m.Destination.Rank() == Rank8 || m.Destination.Rank() == Rank1
+	if (m.PromoType != NoType) != (piece.Type() == Pawn && isLastRank) ||
+		(m.PromoType != NoType && (m.PromoType < Knight || m.PromoType > Queen)) {
+		return m, false
+	}
+
+	if m.HasTag(KingSideCastle | QueenSideCastle) {
+		if piece.Type() != King {
+			return m, false
+		}
+		// Castling has too many conditions, let the move generator decide
+		var moves []Move
+		if color == White {
+			p.bbKingMoves(board.whiteKing, board.whitePieces, board.blackPieces, board.blackKing,
+				tabooSquares(board, color), color, p.HasTag(WhiteCanCastleKingSide), p.HasTag(WhiteCanCastleQueenSide), false, true, false, false, false, &moves)
+		} else {
+			p.bbKingMoves(board.blackKing, board.blackPieces, board.whitePieces, board.whiteKing,
+				tabooSquares(board, color), color, p.HasTag(BlackCanCastleKingSide), p.HasTag(BlackCanCastleQueenSide), false, true, false, false, false, &moves)
+		}
+		for _, move := range moves {
+			if move.Destination == m.Destination && move.Tag&^Check == m.Tag&^Check {
+				return move, true
+			}
+		}
+		return m, false
+	}
+
+	var reachable uint64
+	switch piece.Type() {
+	case Pawn:
+		if color == White && isCapture {
+			reachable = wPawnAnyAttacks(src)
+		} else if color == White {
+			reachable = wSinglePushTargets(src, ^occupied) | wDblPushTargets(src, ^occupied)
+		} else if isCapture {
+			reachable = bPawnAnyAttacks(src)
+		} else {
+			reachable = bSinglePushTargets(src, ^occupied) | bDoublePushTargets(src, ^occupied)
+		}
+	case Knight:
+		reachable = computedKnightAttacks[m.Source]
+	case Bishop:
+		reachable = bishopAttacks(m.Source, occupied, ownPieces)
+	case Rook:
+		reachable = rookAttacks(m.Source, occupied, ownPieces)
+	case Queen:
+		reachable = queenAttacks(m.Source, occupied, ownPieces)
+	case King:
+		// isInCheck does not consider the other king, so it is excluded here
+		otherKing := board.blackKing
+		if color == Black {
+			otherKing = board.whiteKing
+		}
+		reachable = computedKingAttacks[m.Source] &^ kingAttacks(otherKing)
+	}
+	if reachable&dest == 0 {
+		return m, false
+	}
+
+	capturedPiece := p.partialMakeMove(m)
+	legal := !isInCheck(p.Board, color)
+	givesCheck := legal && isInCheck(p.Board, p.Turn())
+	p.partialUnMakeMove(m, capturedPiece)
+
+	if givesCheck {
+		m.SetTag(Check)
+	} else {
+		m.ClearTag(Check)
+	}
+	return m, legal
+}
+
 func (p *Position) HasLegalMoves() bool {
 	color := p.Turn()
 	board := p.Board
@@ -139,40 +364,40 @@ func (p *Position) HasLegalMoves() bool {
 	if isDoubleCheck(board, color) {
 		if color == White {
 			return p.bbKingMoves(board.whiteKing, board.whitePieces, board.blackPieces, board.blackKing,
-				taboo, color, p.HasTag(WhiteCanCastleKingSide), p.HasTag(WhiteCanCastleQueenSide), false, false, true, false, nil)
+				taboo, color, p.HasTag(WhiteCanCastleKingSide), p.HasTag(WhiteCanCastleQueenSide), false, false, false, true, false, nil)
 		} else if color == Black {
 			return p.bbKingMoves(board.blackKing, board.blackPieces, board.whitePieces, board.whiteKing,
-				taboo, color, p.HasTag(BlackCanCastleKingSide), p.HasTag(BlackCanCastleQueenSide), false, false, true, false, nil)
+				taboo, color, p.HasTag(BlackCanCastleKingSide), p.HasTag(BlackCanCastleQueenSide), false, false, false, true, false, nil)
 		}
 		return false
 	} else {
 
 		if color == White {
 			return p.bbPawnMoves(board.whitePawn, board.whitePieces, board.blackPieces,
-				color, p.EnPassant, false, false, true, false, nil) ||
+				color, p.EnPassant, false, false, false, true, false, nil) ||
 				p.bbKnightMoves(board.whiteKnight, board.whitePieces, board.blackPieces,
-					false, false, true, false, nil) ||
+					false, false, false, true, false, nil) ||
 				p.bbSlidingMoves(board.whiteBishop, board.whitePieces, board.blackPieces,
-					color, bishopAttacks, false, false, true, false, nil) ||
+					color, bishopAttacks, false, false, false, true, false, nil) ||
 				p.bbSlidingMoves(board.whiteRook, board.whitePieces, board.blackPieces,
-					color, rookAttacks, false, false, true, false, nil) ||
+					color, rookAttacks, false, false, false, true, false, nil) ||
 				p.bbSlidingMoves(board.whiteQueen, board.whitePieces, board.blackPieces,
-					color, queenAttacks, false, false, true, false, nil) ||
+					color, queenAttacks, false, false, false, true, false, nil) ||
 				p.bbKingMoves(board.whiteKing, board.whitePieces, board.blackPieces, board.blackKing,
-					taboo, color, p.HasTag(WhiteCanCastleKingSide), p.HasTag(WhiteCanCastleQueenSide), false, false, true, false, nil)
+					taboo, color, p.HasTag(WhiteCanCastleKingSide), p.HasTag(WhiteCanCastleQueenSide), false, false, false, true, false, nil)
 		} else if color == Black {
 			return p.bbPawnMoves(board.blackPawn, board.blackPieces, board.whitePieces,
-				color, p.EnPassant, false, false, true, false, nil) ||
+				color, p.EnPassant, false, false, false, true, false, nil) ||
 				p.bbKnightMoves(board.blackKnight, board.blackPieces, board.whitePieces,
-					false, false, true, false, nil) ||
+					false, false, false, true, false, nil) ||
 				p.bbSlidingMoves(board.blackBishop, board.blackPieces, board.whitePieces,
-					color, bishopAttacks, false, false, true, false, nil) ||
+					color, bishopAttacks, false, false, false, true, false, nil) ||
 				p.bbSlidingMoves(board.blackRook, board.blackPieces, board.whitePieces,
-					color, rookAttacks, false, false, true, false, nil) ||
+					color, rookAttacks, false, false, false, true, false, nil) ||
 				p.bbSlidingMoves(board.blackQueen, board.blackPieces, board.whitePieces,
-					color, queenAttacks, false, false, true, false, nil) ||
+					color, queenAttacks, false, false, false, true, false, nil) ||
 				p.bbKingMoves(board.blackKing, board.blackPieces, board.whitePieces, board.whiteKing,
-					taboo, color, p.HasTag(BlackCanCastleKingSide), p.HasTag(BlackCanCastleQueenSide), false, false, true, false, nil)
+					taboo, color, p.HasTag(BlackCanCastleKingSide), p.HasTag(BlackCanCastleQueenSide), false, false, false, true, false, nil)
 		}
 	}
 	return false
@@ -291,7 +516,7 @@ func tabooSquares(b Bitboard, colorOfKing Color) uint64 {
 // Pawns
 
 func (p *Position) bbPawnMoves(bbPawn uint64, ownPieces uint64, otherPieces uint64, color Color, enPassant Square,
-	capturesOnly bool, isPosInCheck bool, isLegalityCheck bool, isQuiescence bool, allMoves *[]Move) bool {
+	capturesOnly bool, quietsOnly bool, isPosInCheck bool, isLegalityCheck bool, isQuiescence bool, allMoves *[]Move) bool {
 	emptySquares := (otherPieces | ownPieces) ^ universal
 	if color == White {
 		for bbPawn != 0 {
@@ -349,6 +574,9 @@ func (p *Position) bbPawnMoves(bbPawn uint64, ownPieces uint64, otherPieces uint
 				}
 			}
 			attacks := wPawnsAble2CaptureAny(pawn, otherPieces)
+			if quietsOnly {
+				attacks = 0
+			}
 			for attacks != 0 {
 				sq := bitScanForward(attacks)
 				dest := Square(sq)
@@ -381,7 +609,7 @@ func (p *Position) bbPawnMoves(bbPawn uint64, ownPieces uint64, otherPieces uint
 				}
 				attacks ^= (1 << sq)
 			}
-			if srcSq.Rank() == Rank5 && enPassant != NoSquare && enPassant.Rank() == Rank6 {
+			if !quietsOnly && srcSq.Rank() == Rank5 && enPassant != NoSquare && enPassant.Rank() == Rank6 {
 				ep := uint64(1 << enPassant)
 				r := wPawnsAble2CaptureAny(pawn, ep)
 				if r != 0 {
@@ -454,6 +682,9 @@ func (p *Position) bbPawnMoves(bbPawn uint64, ownPieces uint64, otherPieces uint
 				}
 			}
 			attacks := bPawnsAble2CaptureAny(pawn, otherPieces)
+			if quietsOnly {
+				attacks = 0
+			}
 			for attacks != 0 {
 				sq := bitScanForward(attacks)
 				dest := Square(sq)
@@ -486,7 +717,7 @@ func (p *Position) bbPawnMoves(bbPawn uint64, ownPieces uint64, otherPieces uint
 				}
 				attacks ^= (1 << sq)
 			}
-			if srcSq.Rank() == Rank4 && enPassant != NoSquare && enPassant.Rank() == Rank3 {
+			if !quietsOnly && srcSq.Rank() == Rank4 && enPassant != NoSquare && enPassant.Rank() == Rank3 {
 				ep := uint64(1 << enPassant)
 				r := bPawnsAble2CaptureAny(pawn, ep)
 				if r != 0 {
@@ -514,13 +745,16 @@ func (p *Position) bbPawnMoves(bbPawn uint64, ownPieces uint64, otherPieces uint
 // Sliding moves, for rooks, queens and bishops
 func (p *Position) bbSlidingMoves(bbPiece uint64, ownPieces uint64, otherPieces uint64,
 	color Color, attacks func(sq Square, occ uint64, own uint64) uint64,
-	capturesOnly bool, isPosInCheck bool, isLegalityCheck bool, isQuiescence bool, allMoves *[]Move) bool {
+	capturesOnly bool, quietsOnly bool, isPosInCheck bool, isLegalityCheck bool, isQuiescence bool, allMoves *[]Move) bool {
 	both := otherPieces | ownPieces
 	for bbPiece != 0 {
 		src := bitScanForward(bbPiece)
 		srcSq := Square(src)
 		rayAttacks := attacks(srcSq, both, ownPieces)
 		captureMoves := rayAttacks & otherPieces
+		if quietsOnly {
+			captureMoves = 0
+		}
 		if !capturesOnly {
 			passiveMoves := rayAttacks &^ otherPieces
 			for passiveMoves != 0 {
@@ -562,7 +796,7 @@ func (p *Position) bbSlidingMoves(bbPiece uint64, ownPieces uint64, otherPieces
 
 // Knights
 func (p *Position) bbKnightMoves(bbPiece uint64, ownPieces uint64, otherPieces uint64,
-	capturesOnly bool, isPosInCheck bool, isLegalityCheck bool, isQuiescence bool, allMoves *[]Move) bool {
+	capturesOnly bool, quietsOnly bool, isPosInCheck bool, isLegalityCheck bool, isQuiescence bool, allMoves *[]Move) bool {
 	both := otherPieces | ownPieces
 	for bbPiece != 0 {
 		src := bitScanForward(bbPiece)
@@ -588,6 +822,9 @@ func (p *Position) bbKnightMoves(bbPiece uint64, ownPieces uint64, otherPieces u
 			}
 		}
 		captures := knightCaptures(srcSq, otherPieces)
+		if quietsOnly {
+			captures = 0
+		}
 		for captures != 0 {
 			sq := bitScanForward(captures)
 			dest := Square(sq)
@@ -613,7 +850,7 @@ func (p *Position) bbKnightMoves(bbPiece uint64, ownPieces uint64, otherPieces u
 // Kings
 func (p *Position) bbKingMoves(bbPiece uint64, ownPieces uint64, otherPieces uint64, otherKing uint64,
 	tabooSquares uint64, color Color, kingSideCastle bool, queenSideCastle bool,
-	capturesOnly bool, isPosInCheck bool, isLegalityCheck bool, isQuiescence bool, allMoves *[]Move) bool {
+	capturesOnly bool, quietsOnly bool, isPosInCheck bool, isLegalityCheck bool, isQuiescence bool, allMoves *[]Move) bool {
 	both := (otherPieces | ownPieces)
 	if bbPiece != 0 {
 		src := bitScanForward(bbPiece)
@@ -687,6 +924,9 @@ func (p *Position) bbKingMoves(bbPiece uint64, ownPieces uint64, otherPieces uin
 			}
 		}
 		captures := kingCaptures(srcSq, otherPieces, tabooSquares)
+		if quietsOnly {
+			captures = 0
+		}
 		for captures != 0 {
 			sq := bitScanForward(captures)
 			dest := Square(sq)
@@ -1064,3 +1304,4 @@ const notABFile = notAFile & notBFile
 const notGHFile = notGFile & notHFile
 const rank4 = uint64(0x00000000FF000000)
 const rank5 = uint64(0x000000FF00000000)
+const rank1And8 = uint64(0xFF000000000000FF)
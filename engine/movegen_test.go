@@ -11,7 +11,7 @@ func TestBishopMoves(t *testing.T) {
 	board := g.position.Board
 	moves := make([]Move, 0, 8)
 	g.position.bbSlidingMoves(board.whiteBishop, board.whitePieces, board.blackPieces,
-		White, bishopAttacks, false, false, false, false, &moves)
+		White, bishopAttacks, false, false, false, false, false, &moves)
 	expectedMoves := []Move{
 		Move{E2, F1, NoType, 0},
 		Move{E2, F3, NoType, 0},
@@ -48,7 +48,7 @@ func TestRookMoves(t *testing.T) {
 	board := g.position.Board
 	moves := make([]Move, 0, 8)
 	g.position.bbSlidingMoves(board.whiteRook, board.whitePieces, board.blackPieces,
-		White, rookAttacks, false, false, false, false, &moves)
+		White, rookAttacks, false, false, false, false, false, &moves)
 	expectedMoves := []Move{
 		Move{H1, G1, NoType, 0},
 		Move{H1, F1, NoType, 0},
@@ -80,7 +80,7 @@ func TestQueenMoves(t *testing.T) {
 	board := g.position.Board
 	moves := make([]Move, 0, 8)
 	g.position.bbSlidingMoves(board.whiteQueen, board.whitePieces, board.blackPieces,
-		White, queenAttacks, false, false, false, false, &moves)
+		White, queenAttacks, false, false, false, false, false, &moves)
 	expectedMoves := []Move{
 		Move{D1, D2, NoType, 0},
 		Move{D1, D3, NoType, 0},
@@ -113,7 +113,7 @@ func TestKingMoves(t *testing.T) {
 	color := White
 	taboo := tabooSquares(board, color)
 	g.position.bbKingMoves(board.whiteKing, board.whitePieces, board.blackPieces, board.blackKing,
-		taboo, color, p.HasTag(WhiteCanCastleKingSide), p.HasTag(WhiteCanCastleQueenSide), false, false, false, false, &moves)
+		taboo, color, p.HasTag(WhiteCanCastleKingSide), p.HasTag(WhiteCanCastleQueenSide), false, false, false, false, false, &moves)
 	expectedMoves := []Move{
 		Move{E1, D2, NoType, Capture},
 		Move{E1, F1, NoType, 0},
@@ -143,7 +143,7 @@ func TestKingCastlingWithOccupiedSquares(t *testing.T) {
 	color := White
 	taboo := tabooSquares(board, color)
 	g.position.bbKingMoves(board.whiteKing, board.whitePieces, board.blackPieces, board.blackKing,
-		taboo, color, p.HasTag(WhiteCanCastleKingSide), p.HasTag(WhiteCanCastleQueenSide), false, false, false, false, &moves)
+		taboo, color, p.HasTag(WhiteCanCastleKingSide), p.HasTag(WhiteCanCastleQueenSide), false, false, false, false, false, &moves)
 	expectedMoves := []Move{
 		Move{E1, E2, NoType, 0},
 		Move{E1, F1, NoType, 0},
@@ -173,7 +173,7 @@ func TestKingQueenSideCastling(t *testing.T) {
 	color := White
 	taboo := tabooSquares(board, color)
 	g.position.bbKingMoves(board.whiteKing, board.whitePieces, board.blackPieces, board.blackKing,
-		taboo, color, p.HasTag(WhiteCanCastleKingSide), p.HasTag(WhiteCanCastleQueenSide), false, false, false, false, &moves)
+		taboo, color, p.HasTag(WhiteCanCastleKingSide), p.HasTag(WhiteCanCastleQueenSide), false, false, false, false, false, &moves)
 	expectedMoves := []Move{
 		Move{E1, E2, NoType, 0},
 		Move{E1, F1, NoType, 0},
@@ -203,7 +203,7 @@ func TestPawnMovesForWhite(t *testing.T) {
 	moves := make([]Move, 0, 8)
 	color := White
 	g.position.bbPawnMoves(board.whitePawn, board.whitePieces, board.blackPieces,
-		color, p.EnPassant, false, false, false, false, &moves)
+		color, p.EnPassant, false, false, false, false, false, &moves)
 	expectedMoves := []Move{
 		Move{H2, H4, NoType, 0},
 		Move{H2, H3, NoType, 0},
@@ -247,7 +247,7 @@ func TestPawnMovesForBlack(t *testing.T) {
 	moves := make([]Move, 0, 8)
 	color := Black
 	g.position.bbPawnMoves(board.blackPawn, board.blackPieces, board.whitePieces,
-		color, p.EnPassant, false, false, false, false, &moves)
+		color, p.EnPassant, false, false, false, false, false, &moves)
 	expectedMoves := []Move{
 		Move{H7, H6, NoType, 0},
 		Move{H7, H5, NoType, 0},
@@ -284,7 +284,7 @@ func TestKnightMoves(t *testing.T) {
 	p := g.position
 	b := p.Board
 	moves := make([]Move, 0, 8)
-	g.position.bbKnightMoves(b.whiteKnight, b.whitePieces, b.blackPieces, false, false, false, false, &moves)
+	g.position.bbKnightMoves(b.whiteKnight, b.whitePieces, b.blackPieces, false, false, false, false, false, &moves)
 	expectedMoves := []Move{
 		Move{G3, F1, NoType, 0},
 		Move{G3, E4, NoType, 0},
@@ -344,7 +344,7 @@ func TestCastleAndPawnAttack(t *testing.T) {
 	color := White
 	taboo := tabooSquares(board, color)
 	g.position.bbKingMoves(board.whiteKing, board.whitePieces, board.blackPieces, board.blackKing,
-		taboo, color, p.HasTag(WhiteCanCastleKingSide), p.HasTag(WhiteCanCastleQueenSide), false, false, false, false, &moves)
+		taboo, color, p.HasTag(WhiteCanCastleKingSide), p.HasTag(WhiteCanCastleQueenSide), false, false, false, false, false, &moves)
 	expectedMoves := []Move{
 		Move{E1, D1, NoType, 0},
 	}
@@ -576,3 +576,118 @@ func containsMove(moves1 []Move, move Move) bool {
 	}
 	return exists
 }
+
+func TestCaptureAndQuietMovesPartitionLegalMoves(t *testing.T) {
+	fens := []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+	}
+	for _, fen := range fens {
+		g := FromFen(fen, true)
+		p := g.Position()
+		captures := p.CaptureMoves()
+		quiets := p.QuietMoves()
+		for _, m := range captures {
+			if !m.HasTag(Capture) {
+				t.Errorf("Non-capture %s is generated as a capture in %s", m.ToString(), fen)
+			}
+		}
+		for _, m := range quiets {
+			if m.HasTag(Capture) {
+				t.Errorf("Capture %s is generated as a quiet move in %s", m.ToString(), fen)
+			}
+		}
+		if !equalMoves(p.LegalMoves(), append(captures, quiets...)) {
+			t.Errorf("Captures and quiet moves do not add up to the legal moves in %s", fen)
+		}
+	}
+}
+
+func TestValidateMoveAgreesWithLegalMoves(t *testing.T) {
+	fens := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+		// The kings are in opposition, they cannot step next to each other
+		"8/8/8/3k4/8/3K4/8/8 w - - 0 1",
+	}
+	tags := []MoveTag{0, Capture, Capture | EnPassant, KingSideCastle, QueenSideCastle}
+	for _, fen := range fens {
+		g := FromFen(fen, true)
+		p := g.Position()
+		legalMoves := p.LegalMoves()
+		for _, m := range legalMoves {
+			if validated, ok := p.ValidateMove(m); !ok || validated != m {
+				t.Errorf("Legal move %s is not validated in %s", m.ToString(), fen)
+			}
+			if m.PromoType != NoType {
+				for _, promoType := range []PieceType{Pawn, King} {
+					invalid := Move{m.Source, m.Destination, promoType, m.Tag}
+					if _, ok := p.ValidateMove(invalid); ok {
+						t.Errorf("Promotion to %d is validated for %s in %s", promoType, m.ToString(), fen)
+					}
+				}
+			}
+		}
+		for src := A1; src <= H8; src++ {
+			for dest := A1; dest <= H8; dest++ {
+				for _, tag := range tags {
+					m := Move{src, dest, NoType, tag}
+					if dest.Rank() == Rank8 || dest.Rank() == Rank1 {
+						m.PromoType = Queen
+					}
+					_, ok := p.ValidateMove(m)
+					isLegal := false
+					for _, legal := range legalMoves {
+						if legal.Source == m.Source && legal.Destination == m.Destination &&
+							legal.PromoType == m.PromoType && legal.Tag&^Check == m.Tag {
+							isLegal = true
+						}
+					}
+					if ok != isLegal {
+						t.Errorf("Move %s with tag %d is validated as %t in %s", m.ToString(), tag, ok, fen)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestQuietChecksAgreesWithLegalMoves(t *testing.T) {
+	fens := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"4k3/8/8/8/4N3/8/8/4R1K1 w - - 0 1",
+		"7k/8/8/8/8/2P5/1B6/K7 w - - 0 1",
+		"k7/8/8/8/8/8/K7/R7 w - - 0 1",
+		"8/8/3k4/8/4P3/8/8/4K3 w - - 0 1",
+		"3r4/8/8/3n4/8/8/8/3K3k b - - 0 1",
+	}
+	for _, fen := range fens {
+		g := FromFen(fen, true)
+		p := g.Position()
+		expected := make(map[Move]bool)
+		for _, m := range p.LegalMoves() {
+			if m.HasTag(Check) && !m.HasTag(Capture|KingSideCastle|QueenSideCastle) && m.PromoType == NoType {
+				expected[m] = true
+			}
+		}
+		actual := p.QuietChecks()
+		if len(actual) != len(expected) {
+			t.Errorf("Expected %d quiet checks but got %d in %s", len(expected), len(actual), fen)
+		}
+		for _, m := range actual {
+			if !expected[m] {
+				t.Errorf("Unexpected quiet check %s in %s", m.ToString(), fen)
+			}
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// The network has one input for every piece on every square, seen from the perspective
+// of each side, the side to move's half of the hidden layer comes first in the output
+const NETWORK_INPUTS = 768
+
+// The quantization of the hidden layer and of the output weights, and the scale of the output
+const (
+	NETWORK_QA    = 255
+	NETWORK_QB    = 64
+	NETWORK_SCALE = 400
+)
+
+// The network files start with this
+const networkMagic = "ZNN1"
+
+// Network is a 768 -> 2xN -> 1 network with clipped ReLU activations. The weights of
+// every input are stored contiguously, so that an input is added to the hidden layer
+// with a single loop over N values
+type Network struct {
+	Hidden         int
+	FeatureWeights []int16 // NETWORK_INPUTS * Hidden
+	FeatureBiases  []int16 // Hidden
+	OutputWeights  []int16 // 2 * Hidden, the side to move first
+	OutputBias     int32
+}
+
+func NewNetwork(hidden int) *Network {
+	return &Network{
+		hidden,
+		make([]int16, NETWORK_INPUTS*hidden),
+		make([]int16, hidden),
+		make([]int16, 2*hidden),
+		0,
+	}
+}
+
+// ReadNetwork reads a network file: the magic, the hidden size as a uint32, and then the
+// weights in the order of the fields of Network, all little endian
+func ReadNetwork(reader io.Reader) (*Network, error) {
+	magic := make([]byte, len(networkMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != networkMagic {
+		return nil, fmt.Errorf("not a network file")
+	}
+	var hidden uint32
+	if err := binary.Read(reader, binary.LittleEndian, &hidden); err != nil {
+		return nil, err
+	}
+	if hidden == 0 || hidden > 4096 {
+		return nil, fmt.Errorf("unsupported hidden layer size %d", hidden)
+	}
+	net := NewNetwork(int(hidden))
+	for _, data := range []interface{}{net.FeatureWeights, net.FeatureBiases, net.OutputWeights, &net.OutputBias} {
+		if err := binary.Read(reader, binary.LittleEndian, data); err != nil {
+			return nil, err
+		}
+	}
+	return net, nil
+}
+
+func LoadNetwork(path string) (*Network, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadNetwork(bufio.NewReader(file))
+}
+
+func (n *Network) Write(writer io.Writer) error {
+	if _, err := writer.Write([]byte(networkMagic)); err != nil {
+		return err
+	}
+	for _, data := range []interface{}{uint32(n.Hidden), n.FeatureWeights, n.FeatureBiases, n.OutputWeights, n.OutputBias} {
+		if err := binary.Write(writer, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The network positions are evaluated with, holding a nil *Network when the hand crafted
+// evaluation is used. It can be replaced while a search is running, the accumulators of
+// the old network are then rebuilt for the new one
+var currentNetwork = func() *atomic.Value {
+	value := &atomic.Value{}
+	value.Store((*Network)(nil))
+	return value
+}()
+
+func SetNetwork(net *Network) {
+	currentNetwork.Store(net)
+}
+
+func CurrentNetwork() *Network {
+	return currentNetwork.Load().(*Network)
+}
+
+// Accumulator is the hidden layer of the network before the activation, for both
+// perspectives. It is updated with every move that is made and unmade
+type Accumulator struct {
+	network *Network
+	values  [2][]int16
+}
+
+func newAccumulator(net *Network, board *Bitboard) *Accumulator {
+	a := &Accumulator{net, [2][]int16{make([]int16, net.Hidden), make([]int16, net.Hidden)}}
+	a.refresh(board)
+	return a
+}
+
+func (a *Accumulator) copy() *Accumulator {
+	return &Accumulator{a.network, [2][]int16{
+		append([]int16(nil), a.values[White]...),
+		append([]int16(nil), a.values[Black]...),
+	}}
+}
+
+// refresh computes the accumulator from scratch
+func (a *Accumulator) refresh(board *Bitboard) {
+	copy(a.values[White], a.network.FeatureBiases)
+	copy(a.values[Black], a.network.FeatureBiases)
+	for piece := WhiteKing; piece < NoPiece; piece++ {
+		bb := board.GetBitboardOf(piece)
+		for bb != 0 {
+			sq := Square(bitScanForward(bb))
+			a.add(piece, sq)
+			bb &= bb - 1
+		}
+	}
+}
+
+// inputs are the indices of the piece on the square, from white's and black's perspectives
+func inputs(piece Piece, sq Square) (int, int) {
+	white := int(piece)*64 + int(sq)
+	// For black, the colors are swapped and the board is flipped vertically
+	black := (int(piece)+6)%12*64 + int(sq^56)
+	return white, black
+}
+
+func (a *Accumulator) add(piece Piece, sq Square) {
+	white, black := inputs(piece, sq)
+	hidden := a.network.Hidden
+	addWeights(a.values[White], a.network.FeatureWeights[white*hidden:(white+1)*hidden])
+	addWeights(a.values[Black], a.network.FeatureWeights[black*hidden:(black+1)*hidden])
+}
+
+func (a *Accumulator) remove(piece Piece, sq Square) {
+	white, black := inputs(piece, sq)
+	hidden := a.network.Hidden
+	subWeights(a.values[White], a.network.FeatureWeights[white*hidden:(white+1)*hidden])
+	subWeights(a.values[Black], a.network.FeatureWeights[black*hidden:(black+1)*hidden])
+}
+
+func (a *Accumulator) move(piece Piece, src Square, dest Square) {
+	a.remove(piece, src)
+	a.add(piece, dest)
+}
+
+// updateAccumulatorForCastling moves the rook of a castling move, or moves it back
+func updateAccumulatorForCastling(a *Accumulator, move Move, undo bool) {
+	var rook Piece
+	var src, dest Square
+	switch {
+	case move.HasTag(KingSideCastle) && move.Destination == G1:
+		rook, src, dest = WhiteRook, H1, F1
+	case move.HasTag(KingSideCastle) && move.Destination == G8:
+		rook, src, dest = BlackRook, H8, F8
+	case move.HasTag(QueenSideCastle) && move.Destination == C1:
+		rook, src, dest = WhiteRook, A1, D1
+	case move.HasTag(QueenSideCastle) && move.Destination == C8:
+		rook, src, dest = BlackRook, A8, D8
+	default:
+		return
+	}
+	if undo {
+		src, dest = dest, src
+	}
+	a.move(rook, src, dest)
+}
+
+// The loops are kept simple, with the bounds checks hoisted, so that the compiler
+// can unroll them
+func addWeights(values []int16, weights []int16) {
+	weights = weights[:len(values)]
+	for i := range values {
+		values[i] += weights[i]
+	}
+}
+
+func subWeights(values []int16, weights []int16) {
+	weights = weights[:len(values)]
+	for i := range values {
+		values[i] -= weights[i]
+	}
+}
+
+func clippedReLU(value int16) int32 {
+	if value < 0 {
+		return 0
+	} else if value > NETWORK_QA {
+		return NETWORK_QA
+	}
+	return int32(value)
+}
+
+func (a *Accumulator) output(turn Color) int32 {
+	hidden := a.network.Hidden
+	us := a.values[turn]
+	them := a.values[turn.Other()]
+	usWeights := a.network.OutputWeights[:hidden]
+	themWeights := a.network.OutputWeights[hidden : 2*hidden]
+	// A single product fits in an int32, but their sum does not with the bigger hidden layers
+	sum := int64(a.network.OutputBias)
+	for i := range us {
+		sum += int64(clippedReLU(us[i]) * int32(usWeights[i]))
+	}
+	for i := range them {
+		sum += int64(clippedReLU(them[i]) * int32(themWeights[i]))
+	}
+	return int32(sum * NETWORK_SCALE / (NETWORK_QA * NETWORK_QB))
+}
+
+// liveAccumulator is the accumulator of the position, if it belongs to the current network
+func (p *Position) liveAccumulator() *Accumulator {
+	if p.accumulator != nil && p.accumulator.network != CurrentNetwork() {
+		p.accumulator = nil
+	}
+	return p.accumulator
+}
+
+// NetworkEvaluate is the score of the position for the side to move, according to the
+// current network. The accumulator is built the first time the position is evaluated,
+// and then it is kept up to date by the moves
+func (p *Position) NetworkEvaluate() int32 {
+	net := CurrentNetwork()
+	if net == nil {
+		return 0
+	}
+	if p.accumulator == nil || p.accumulator.network != net {
+		p.accumulator = newAccumulator(net, &p.Board)
+	}
+	return p.accumulator.output(p.Turn())
+}
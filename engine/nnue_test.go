@@ -0,0 +1,156 @@
+package engine
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func randomNetwork(hidden int) *Network {
+	random := rand.New(rand.NewSource(42))
+	net := NewNetwork(hidden)
+	for i := range net.FeatureWeights {
+		net.FeatureWeights[i] = int16(random.Intn(129) - 64)
+	}
+	for i := range net.FeatureBiases {
+		net.FeatureBiases[i] = int16(random.Intn(129) - 64)
+	}
+	for i := range net.OutputWeights {
+		net.OutputWeights[i] = int16(random.Intn(129) - 64)
+	}
+	net.OutputBias = 1234
+	return net
+}
+
+// checkAccumulators walks the move tree, and compares the incremental accumulator
+// to the one computed from scratch after every move and every undo
+func checkAccumulators(t *testing.T, p *Position, depth int) {
+	if depth == 0 {
+		return
+	}
+	for _, move := range p.LegalMoves() {
+		cp, ep, tg, hc := p.MakeMove(move)
+		expected := newAccumulator(p.accumulator.network, &p.Board)
+		if !reflect.DeepEqual(p.accumulator.values, expected.values) {
+			t.Fatalf("The accumulator is wrong after %s in %s", move.ToString(), p.Fen())
+		}
+		checkAccumulators(t, p, depth-1)
+		p.UnMakeMove(move, tg, ep, cp, hc)
+		expected = newAccumulator(p.accumulator.network, &p.Board)
+		if !reflect.DeepEqual(p.accumulator.values, expected.values) {
+			t.Fatalf("The accumulator is wrong after undoing %s in %s", move.ToString(), p.Fen())
+		}
+	}
+}
+
+func TestIncrementalAccumulator(t *testing.T) {
+	SetNetwork(randomNetwork(16))
+	defer SetNetwork(nil)
+
+	fens := []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		// Castling on both sides, captures of rooks and promotions
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		// En passant
+		"8/8/8/2k5/2pP4/8/B7/4K3 b - d3 0 3",
+	}
+	for _, fen := range fens {
+		p := PositionFromFen(fen)
+		before := p.NetworkEvaluate()
+		checkAccumulators(t, p, 3)
+		if after := p.NetworkEvaluate(); after != before {
+			t.Errorf("Expected the evaluation of %s to be back to %d, got %d", fen, before, after)
+		}
+	}
+}
+
+func TestNetworkEvaluate(t *testing.T) {
+	net := randomNetwork(8)
+	SetNetwork(net)
+	defer SetNetwork(nil)
+
+	// The network is symmetric, so mirrored positions evaluate the same for the side to move
+	p := PositionFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	mirrored := PositionFromFen("r3k2r/pppbbppp/2n2q1P/1P2p3/3pn3/BN2PNP1/P1PPQPB1/R3K2R b KQkq - 0 1")
+	if p.NetworkEvaluate() != mirrored.NetworkEvaluate() {
+		t.Errorf("Expected mirrored positions to evaluate the same, got %d and %d",
+			p.NetworkEvaluate(), mirrored.NetworkEvaluate())
+	}
+
+	// A copy keeps its own accumulator
+	copied := p.Copy()
+	copied.MakeMove(copied.LegalMoves()[0])
+	if p.NetworkEvaluate() != mirrored.NetworkEvaluate() {
+		t.Error("Moves on a copy should not change the original position")
+	}
+
+	// Changing the network rebuilds the accumulators
+	other := randomNetwork(4)
+	other.OutputBias = 0
+	SetNetwork(other)
+	if p.accumulator.network == other {
+		t.Error("The accumulator should not be rebuilt before it is used")
+	}
+	p.NetworkEvaluate()
+	if p.accumulator.network != other || len(p.accumulator.values[White]) != 4 {
+		t.Error("Expected the accumulator to be rebuilt for the new network")
+	}
+}
+
+func TestNetworkOutputDoesNotOverflow(t *testing.T) {
+	// The biggest hidden layer that is accepted, with every activation and weight at its maximum
+	net := NewNetwork(4096)
+	for i := range net.FeatureBiases {
+		net.FeatureBiases[i] = NETWORK_QA
+	}
+	for i := range net.OutputWeights {
+		net.OutputWeights[i] = 32767
+	}
+	a := newAccumulator(net, &Bitboard{})
+	expected := int32(int64(NETWORK_QA) * 32767 * 2 * 4096 * NETWORK_SCALE / (NETWORK_QA * NETWORK_QB))
+	if output := a.output(White); output != expected {
+		t.Errorf("Expected the output to be %d, got %d", expected, output)
+	}
+}
+
+func TestNetworkFile(t *testing.T) {
+	net := randomNetwork(8)
+	var buffer bytes.Buffer
+	if err := net.Write(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadNetwork(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(net, read) {
+		t.Error("Expected the network to be read back as it was written")
+	}
+	if _, err := ReadNetwork(bytes.NewReader([]byte("not a network"))); err == nil {
+		t.Error("Expected an error for a file that is not a network")
+	}
+}
+
+func TestNetworkCanBeSetWhileEvaluating(t *testing.T) {
+	net := randomNetwork(8)
+	defer SetNetwork(nil)
+
+	done := make(chan bool)
+	go func() {
+		p := PositionFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+		for i := 0; i < 200; i++ {
+			move := p.LegalMoves()[0]
+			cp, ep, tg, hc := p.MakeMove(move)
+			p.NetworkEvaluate()
+			p.UnMakeMove(move, tg, ep, cp, hc)
+		}
+		done <- true
+	}()
+	for i := 0; i < 200; i++ {
+		SetNetwork(net)
+		SetNetwork(nil)
+	}
+	<-done
+}
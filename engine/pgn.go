@@ -1,8 +1,11 @@
 package engine
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"strings"
+	"unicode"
 )
 
 func (p *Position) ParseMoves(moveStr []string) []Move {
@@ -29,3 +32,202 @@ func (p *Position) ParseMoves(moveStr []string) []Move {
 		return append(append([]Move{}, parsed), otherMoves...)
 	}
 }
+
+// ParseSAN finds the legal move that matches a move in Standard Algebraic Notation
+func (p *Position) ParseSAN(san string) (Move, error) {
+	notation := strings.TrimRight(strings.TrimSpace(san), "+#!?")
+	notation = strings.TrimSuffix(notation, "e.p.")
+	legalMoves := p.LegalMoves()
+
+	if notation == "O-O" || notation == "0-0" || notation == "O-O-O" || notation == "0-0-0" {
+		tag := KingSideCastle
+		if len(notation) == 5 {
+			tag = QueenSideCastle
+		}
+		for _, move := range legalMoves {
+			if move.HasTag(tag) {
+				return move, nil
+			}
+		}
+		return Move{NoSquare, NoSquare, NoType, 0}, fmt.Errorf("%s is not a legal move in %s", san, p.Fen())
+	}
+
+	pieceType := Pawn
+	switch {
+	case strings.HasPrefix(notation, "N"):
+		pieceType = Knight
+	case strings.HasPrefix(notation, "B"):
+		pieceType = Bishop
+	case strings.HasPrefix(notation, "R"):
+		pieceType = Rook
+	case strings.HasPrefix(notation, "Q"):
+		pieceType = Queen
+	case strings.HasPrefix(notation, "K"):
+		pieceType = King
+	}
+	if pieceType != Pawn {
+		notation = notation[1:]
+	}
+
+	promoType := NoType
+	if index := strings.IndexAny(notation, "=NBRQ"); index != -1 && pieceType == Pawn {
+		switch strings.TrimPrefix(notation[index:], "=") {
+		case "N":
+			promoType = Knight
+		case "B":
+			promoType = Bishop
+		case "R":
+			promoType = Rook
+		case "Q":
+			promoType = Queen
+		}
+		notation = notation[:index]
+	}
+
+	notation = strings.Replace(notation, "x", "", 1)
+	if len(notation) < 2 {
+		return Move{NoSquare, NoSquare, NoType, 0}, fmt.Errorf("%s is not a valid SAN move", san)
+	}
+	destination, ok := NameToSquareMap[notation[len(notation)-2:]]
+	if !ok {
+		return Move{NoSquare, NoSquare, NoType, 0}, fmt.Errorf("%s is not a valid SAN move", san)
+	}
+	disambiguation := notation[:len(notation)-2]
+
+	candidates := make([]Move, 0, 2)
+	for _, move := range legalMoves {
+		piece := p.Board.PieceAt(move.Source)
+		if move.Destination != destination || piece.Type() != pieceType || move.PromoType != promoType {
+			continue
+		}
+		matches := true
+		for _, ch := range disambiguation {
+			if ch >= 'a' && ch <= 'h' && move.Source.File() != File(ch-'a') {
+				matches = false
+			} else if ch >= '1' && ch <= '8' && move.Source.Rank() != Rank(ch-'1') {
+				matches = false
+			}
+		}
+		if matches {
+			candidates = append(candidates, move)
+		}
+	}
+	if len(candidates) > 1 {
+		return Move{NoSquare, NoSquare, NoType, 0}, fmt.Errorf("%s is ambiguous in %s", san, p.Fen())
+	} else if len(candidates) == 0 {
+		return Move{NoSquare, NoSquare, NoType, 0}, fmt.Errorf("%s is not a legal move in %s", san, p.Fen())
+	}
+	return candidates[0], nil
+}
+
+type PGNGame struct {
+	Tags  map[string]string
+	Moves []string
+}
+
+// Result returns the result of the game, as recorded in the game's tags
+func (g *PGNGame) Result() string {
+	result, ok := g.Tags["Result"]
+	if !ok {
+		return "*"
+	}
+	return result
+}
+
+// PGNReader reads games one by one from a PGN collection, only the main line of
+// every game is kept, comments, variations and numeric annotation glyphs are dropped
+type PGNReader struct {
+	reader *bufio.Reader
+}
+
+func NewPGNReader(reader io.Reader) *PGNReader {
+	return &PGNReader{bufio.NewReader(reader)}
+}
+
+func isPGNResult(token string) bool {
+	return token == "1-0" || token == "0-1" || token == "1/2-1/2" || token == "*"
+}
+
+// Next returns the next game in the collection, or io.EOF when there are no more games
+func (r *PGNReader) Next() (*PGNGame, error) {
+	game := &PGNGame{make(map[string]string), []string{}}
+	token := strings.Builder{}
+	hasContent := false
+	variationDepth := 0
+
+	flush := func() bool {
+		word := token.String()
+		token.Reset()
+		if word == "" || variationDepth > 0 {
+			return false
+		}
+		hasContent = true
+		if isPGNResult(word) {
+			if _, ok := game.Tags["Result"]; !ok {
+				game.Tags["Result"] = word
+			}
+			return true
+		}
+		// drop move numbers, like 12. and 12...
+		if index := strings.LastIndex(word, "."); index != -1 {
+			word = word[index+1:]
+		}
+		if word != "" && !strings.HasPrefix(word, "$") {
+			game.Moves = append(game.Moves, word)
+		}
+		return false
+	}
+
+	for {
+		ch, _, err := r.reader.ReadRune()
+		if err != nil {
+			if err == io.EOF && (flush() || hasContent) {
+				return game, nil
+			}
+			return nil, err
+		}
+		switch {
+		case ch == '[' && variationDepth == 0 && token.Len() == 0:
+			line, err := r.reader.ReadString(']')
+			if err != nil {
+				return nil, err
+			}
+			line = strings.TrimSuffix(line, "]")
+			parts := strings.SplitN(line, " ", 2)
+			if len(parts) == 2 {
+				game.Tags[parts[0]] = strings.Trim(strings.TrimSpace(parts[1]), "\"")
+			}
+			hasContent = true
+		case ch == '{':
+			if flush() {
+				return game, nil
+			}
+			if _, err := r.reader.ReadString('}'); err != nil {
+				return nil, err
+			}
+		case ch == ';':
+			if flush() {
+				return game, nil
+			}
+			if _, err := r.reader.ReadString('\n'); err != nil && err != io.EOF {
+				return nil, err
+			}
+		case ch == '(':
+			if flush() {
+				return game, nil
+			}
+			variationDepth++
+		case ch == ')':
+			token.Reset()
+			if variationDepth > 0 {
+				variationDepth--
+			}
+		case unicode.IsSpace(ch):
+			if flush() {
+				return game, nil
+			}
+		default:
+			token.WriteRune(ch)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package engine
 
 import (
 	"fmt"
+	"io"
+	"strings"
 	"testing"
 )
 
@@ -27,3 +29,85 @@ func TestPGNParsing(t *testing.T) {
 			fmt.Sprintf("\nExpected: %d\nGot: %d\n", len(expected), len(actual)))
 	}
 }
+
+func TestSANParsing(t *testing.T) {
+	fen := "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q2/PPPBBPpP/R3K2R b KQkq - 0 1"
+	game := FromFen(fen, true)
+	position := game.Position()
+	tests := []struct {
+		san      string
+		expected Move
+	}{
+		{"gxh1=Q+", Move{G2, H1, Queen, Capture | Check}},
+		{"gxh1N", Move{G2, H1, Knight, Capture}},
+		{"g1=Q", Move{G2, G1, Queen, Check}},
+		{"O-O", Move{E8, G8, NoType, KingSideCastle}},
+		{"O-O-O", Move{E8, C8, NoType, QueenSideCastle}},
+		{"Bxe2", Move{A6, E2, NoType, Capture}},
+		{"Nbxd5", Move{B6, D5, NoType, Capture}},
+		{"Nfxd5", Move{F6, D5, NoType, Capture}},
+		{"exd5!?", Move{E6, D5, NoType, Capture}},
+		{"bxc3", Move{B4, C3, NoType, Capture}},
+		{"Rh2", Move{H8, H2, NoType, Capture}},
+	}
+
+	for _, test := range tests {
+		actual, err := position.ParseSAN(test.san)
+		if err != nil {
+			t.Errorf("Could not parse %s: %s", test.san, err)
+		} else if actual != test.expected {
+			t.Errorf("Unexpected move for %s:%s\n", test.san,
+				fmt.Sprintf("Expected: %s\nGot: %s\n", test.expected.ToString(), actual.ToString()))
+		}
+	}
+
+	if _, err := position.ParseSAN("Nxd5"); err == nil {
+		t.Errorf("Ambiguous move Nxd5 should not be parsed")
+	}
+	if _, err := position.ParseSAN("Ke6"); err == nil {
+		t.Errorf("Illegal move Ke6 should not be parsed")
+	}
+}
+
+func TestPGNReader(t *testing.T) {
+	pgn := `[Event "Casual Game"]
+[White "Zahak"]
+[Black "Zahak"]
+[Result "1-0"]
+[WhiteElo "2000"]
+
+1. e4 e5 2. Nf3 {The king's knight} Nc6 (2... d6 3. d4) 3. Bb5 $1 a6 ; Morphy
+4. Ba4 1-0
+
+[Event "Casual Game"]
+[Result "1/2-1/2"]
+
+1.d4 d5 2.c4 1/2-1/2
+`
+	reader := NewPGNReader(strings.NewReader(pgn))
+
+	game, err := reader.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"e4", "e5", "Nf3", "Nc6", "Bb5", "a6", "Ba4"}
+	if strings.Join(game.Moves, " ") != strings.Join(expected, " ") {
+		t.Errorf("Unexpected moves:%s\n", fmt.Sprintf("Expected: %v\nGot: %v\n", expected, game.Moves))
+	}
+	if game.Result() != "1-0" || game.Tags["WhiteElo"] != "2000" {
+		t.Errorf("Unexpected tags: %v", game.Tags)
+	}
+
+	game, err = reader.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"d4", "d5", "c4"}
+	if strings.Join(game.Moves, " ") != strings.Join(expected, " ") || game.Result() != "1/2-1/2" {
+		t.Errorf("Unexpected second game:%s\n", fmt.Sprintf("Expected: %v\nGot: %v\n", expected, game.Moves))
+	}
+
+	if _, err = reader.Next(); err != io.EOF {
+		t.Errorf("Expected the end of the collection, got: %v", err)
+	}
+}
@@ -11,6 +11,7 @@ type Position struct {
 	hash          uint64
 	Positions     intintmap.Map
 	HalfMoveClock uint8
+	accumulator   *Accumulator // Only used when evaluating with a network
 }
 
 type PositionTag uint8
@@ -63,6 +64,7 @@ func (p *Position) UnMakeNullMove(ep Square) {
 	p.EnPassant = ep
 	p.HalfMoveClock -= 1
 	p.ToggleTurn()
+	updateHashForNullMove(p, ep, NoSquare)
 }
 
 func (p *Position) ToggleTurn() {
@@ -172,6 +174,19 @@ func (p *Position) MakeMove(move Move) (Piece, Square, PositionTag, uint8) {
 		p.Board.UpdateSquare(move.Destination, promoPiece)
 	}
 
+	if accumulator := p.liveAccumulator(); accumulator != nil {
+		if captureSquare != NoSquare {
+			accumulator.remove(capturedPiece, captureSquare)
+		}
+		accumulator.remove(movingPiece, move.Source)
+		if promoPiece != NoPiece {
+			accumulator.add(promoPiece, move.Destination)
+		} else {
+			accumulator.add(movingPiece, move.Destination)
+		}
+		updateAccumulatorForCastling(accumulator, move, false)
+	}
+
 	if movingPiece == BlackKing {
 		p.ClearTag(BlackCanCastleKingSide)
 		p.ClearTag(BlackCanCastleQueenSide)
@@ -261,6 +276,14 @@ func (p *Position) UnMakeMove(move Move, tag PositionTag, enPassant Square, capt
 			p.Board.Move(F8, H8)
 		}
 	}
+	if accumulator := p.liveAccumulator(); accumulator != nil {
+		accumulator.remove(promoPiece, move.Destination)
+		accumulator.add(movingPiece, move.Source)
+		if captureSquare != NoSquare {
+			accumulator.add(capturedPiece, captureSquare)
+		}
+		updateAccumulatorForCastling(accumulator, move, true)
+	}
 	updateHash(p, move, movingPiece, capturedPiece, captureSquare, p.EnPassant, oldEnPassant, promoPiece, oldTag)
 }
 
@@ -276,6 +299,16 @@ func (p *Position) IsEndGame() bool {
 	return p.Board.IsEndGame()
 }
 
+// HasNonPawnMaterial checks whether the side to move has any piece other than the
+// king and pawns, when it does not, zugzwang is likely
+func (p *Position) HasNonPawnMaterial() bool {
+	return p.Board.HasNonPawnMaterial(p.Turn())
+}
+
+func (p *Position) Phase() int32 {
+	return p.Board.Phase()
+}
+
 func (p *Position) IsInCheck() bool {
 	return isInCheck(p.Board, p.Turn())
 }
@@ -371,11 +404,20 @@ func findEnPassantCaptureSquare(move Move) Square {
 	return SquareOf(file, rank)
 }
 
+// Copy returns an independent copy of the position, including its history
+func (p *Position) Copy() *Position {
+	return p.copy()
+}
+
 func (p *Position) copy() *Position {
 	copyMap := intintmap.New(10000, 0.5)
 	for item := range p.Positions.Items() {
 		copyMap.Put(item[0], item[1])
 	}
+	var accumulator *Accumulator
+	if p.liveAccumulator() != nil {
+		accumulator = p.accumulator.copy()
+	}
 	return &Position{
 		*p.Board.copy(),
 		p.EnPassant,
@@ -383,5 +425,6 @@ func (p *Position) copy() *Position {
 		p.hash,
 		*copyMap,
 		p.HalfMoveClock,
+		accumulator,
 	}
 }
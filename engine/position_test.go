@@ -189,3 +189,43 @@ func TestUnMakeMovePromotion(t *testing.T) {
 		t.Errorf("But expected: %d\n", startHash)
 	}
 }
+
+func TestHasNonPawnMaterial(t *testing.T) {
+	game := FromFen("8/8/8/2Kp4/3Pk3/8/8/8 w - - 0 1", true)
+	if game.Position().HasNonPawnMaterial() {
+		t.Errorf("Expected only kings and pawns")
+	}
+	game = FromFen("8/8/8/2Kp4/3Pk3/8/8/7n w - - 0 1", true)
+	if game.Position().HasNonPawnMaterial() {
+		t.Errorf("Expected the black knight to be ignored when white is to move")
+	}
+	game = FromFen("8/8/8/2Kp4/3Pk3/8/8/7n b - - 0 1", true)
+	if !game.Position().HasNonPawnMaterial() {
+		t.Errorf("Expected the black knight to be counted")
+	}
+}
+
+func TestUnMakeNullMoveRestoresTheHash(t *testing.T) {
+	game := FromFen("rnbqkbnr/pPp1pppp/4P3/3pP3/4p3/5BN1/PP3PPP/RNBQK2R w KQkq d6 0 1", true)
+	position := game.position
+	expected := position.Hash()
+	ep := position.MakeNullMove()
+	if position.Hash() == expected {
+		t.Errorf("Expected the null move to change the hash")
+	}
+	position.UnMakeNullMove(ep)
+	if position.Hash() != expected {
+		t.Errorf("Expected the hash to be restored\nGot: %d\nBut expected: %d\n", position.Hash(), expected)
+	}
+}
+
+func TestPhase(t *testing.T) {
+	game := FromFen("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", true)
+	if phase := game.Position().Phase(); phase != MAX_PHASE {
+		t.Errorf("Expected the opening phase to be %d, got: %d", MAX_PHASE, phase)
+	}
+	game = FromFen("4k3/pp6/8/8/8/8/PP6/R3K3 w - - 0 1", true)
+	if phase := game.Position().Phase(); phase != 2 {
+		t.Errorf("Expected a single rook to count 2, got: %d", phase)
+	}
+}
@@ -11,7 +11,7 @@ const CHECKMATE_EVAL int32 = 400_000
 // Piece Square Tables
 
 // Middle game
-var earlyPawnPst = [64]int32{
+var defaultEarlyPawnPst = [64]int32{
 	0, 0, 0, 0, 0, 0, 0, 0,
 	80, 80, 80, 80, 80, 80, 80, 80,
 	50, 50, 50, 50, 50, 50, 50, 50,
@@ -22,7 +22,7 @@ var earlyPawnPst = [64]int32{
 	0, 0, 0, 0, 0, 0, 0, 0,
 }
 
-var earlyKnightPst = [64]int32{
+var defaultEarlyKnightPst = [64]int32{
 	-40, -25, -25, -25, -25, -25, -25, -40,
 	-30, 0, 0, 0, 0, 0, 0, -30,
 	-30, 0, 0, 0, 0, 0, 0, -30,
@@ -33,7 +33,7 @@ var earlyKnightPst = [64]int32{
 	-40, -30, -25, -25, -25, -25, -30, -40,
 }
 
-var earlyBishopPst = [64]int32{
+var defaultEarlyBishopPst = [64]int32{
 	-10, 0, 0, 0, 0, 0, 0, -10,
 	-10, 5, 0, 0, 0, 0, 5, -10,
 	-10, 0, 5, 0, 0, 5, 0, -10,
@@ -44,7 +44,7 @@ var earlyBishopPst = [64]int32{
 	-10, -20, -20, -20, -20, -20, -20, -10,
 }
 
-var earlyRookPst = [64]int32{
+var defaultEarlyRookPst = [64]int32{
 	0, 0, 0, 0, 0, 0, 0, 0,
 	10, 10, 10, 10, 10, 10, 10, 10,
 	0, 0, 0, 0, 0, 0, 0, 0,
@@ -55,7 +55,7 @@ var earlyRookPst = [64]int32{
 	0, 0, 0, 5, 5, 0, 0, 0,
 }
 
-var earlyQueenPst = [64]int32{
+var defaultEarlyQueenPst = [64]int32{
 	-25, -25, -25, -25, -25, -25, -25, -25,
 	-25, -25, -25, -25, -25, -25, -25, -25,
 	-25, -25, -25, -25, -25, -25, -25, -25,
@@ -66,7 +66,7 @@ var earlyQueenPst = [64]int32{
 	5, 5, 10, 15, 15, 10, 5, 5,
 }
 
-var earlyKingPst = [64]int32{
+var defaultEarlyKingPst = [64]int32{
 	-25, -25, -25, -25, -25, -25, -25, -25,
 	-25, -25, -25, -25, -25, -25, -25, -25,
 	-25, -25, -25, -25, -25, -25, -25, -25,
@@ -79,7 +79,7 @@ var earlyKingPst = [64]int32{
 
 // Endgame
 
-var latePawnPst = [64]int32{
+var defaultLatePawnPst = [64]int32{
 	0, 0, 0, 0, 0, 0, 0, 0,
 	200, 200, 200, 200, 200, 200, 200, 200,
 	150, 150, 150, 150, 150, 150, 150, 150,
@@ -90,18 +90,18 @@ var latePawnPst = [64]int32{
 	0, 0, 0, 0, 0, 0, 0, 0,
 }
 
-var lateKnightPst = [64]int32{
-	-30, -20, -10, -20, -20, -20, -30, -30,
-	-10, -10, -10, -5, -5, -10, -10, -10,
-	-10, -10, 10, 10, -10, -10, -10, -10,
-	-10, 5, 10, 10, 10, 10, 10, -10,
-	-10, -5, 10, 15, 10, 15, 5, -10,
-	-10, -5, 0, 10, 10, 0, -10, -10,
-	-25, -20, -10, -5, -5, -20, -20, -25,
-	-30, -30, -30, -10, -10, -30, -30, -30,
+var defaultLateKnightPst = [64]int32{
+	-50, -40, -30, -30, -30, -30, -40, -50,
+	-40, -20, 0, 0, 0, 0, -20, -40,
+	-30, 0, 10, 15, 15, 10, 0, -30,
+	-30, 5, 15, 20, 20, 15, 5, -30,
+	-30, 0, 15, 20, 20, 15, 0, -30,
+	-30, 5, 10, 15, 15, 10, 5, -30,
+	-40, -20, 0, 5, 5, 0, -20, -40,
+	-50, -40, -30, -30, -30, -30, -40, -50,
 }
 
-var lateBishopPst = [64]int32{
+var defaultLateBishopPst = [64]int32{
 	-10, -10, -10, -10, -10, -10, -10, -10,
 	-10, -5, 5, -10, -5, -10, -5, -10,
 	5, -10, 0, 0, 0, 5, 0, 5,
@@ -112,7 +112,7 @@ var lateBishopPst = [64]int32{
 	-15, -10, -15, -5, -10, -10, -5, -15,
 }
 
-var lateRookPst = [64]int32{
+var defaultLateRookPst = [64]int32{
 	15, 10, 15, 15, 15, 15, 10, 5,
 	10, 10, 10, 10, 5, 5, 10, 5,
 	5, 5, 5, 5, 5, 5, 5, 5,
@@ -123,7 +123,7 @@ var lateRookPst = [64]int32{
 	-10, -10, -10, -10, -10, -10, -10, -10,
 }
 
-var lateQueenPst = [64]int32{
+var defaultLateQueenPst = [64]int32{
 	-10, 20, 20, 25, 25, 20, 10, 20,
 	-15, 20, 30, 40, 40, 20, 20, 0,
 	-20, 5, 10, 30, 30, 30, 5, -20,
@@ -134,7 +134,7 @@ var lateQueenPst = [64]int32{
 	-30, -30, -20, -30, -5, -20, -20, -20,
 }
 
-var lateKingPst = [64]int32{
+var defaultLateKingPst = [64]int32{
 	-50, -50, -50, -50, -50, -50, -50, -50,
 	-15, 15, 15, 15, 15, 15, 15, -15,
 	10, 15, 20, 15, 20, 20, 15, 10,
@@ -145,6 +145,20 @@ var lateKingPst = [64]int32{
 	-40, -40, -20, -10, -10, -20, -40, -40,
 }
 
+// The middlegame penalty of the king by the attack units
+var defaultKingDanger = [KING_DANGER_UNITS]int32{
+	0, 0, 1, 2, 3, 5, 7, 9, 12, 15,
+	18, 22, 26, 30, 35, 39, 44, 50, 56, 62,
+	68, 75, 82, 85, 89, 97, 105, 113, 122, 131,
+	140, 150, 169, 180, 191, 202, 213, 225, 237, 248,
+	260, 272, 283, 295, 307, 319, 330, 342, 354, 366,
+	377, 389, 401, 412, 424, 436, 448, 459, 471, 483,
+	494, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+	500, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+	500, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+	500, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+}
+
 var flip = [64]int32{
 	56, 57, 58, 59, 60, 61, 62, 63,
 	48, 49, 50, 51, 52, 53, 54, 55,
@@ -156,16 +170,44 @@ var flip = [64]int32{
 	0, 1, 2, 3, 4, 5, 6, 7,
 }
 
+// Score is a pair of middlegame and endgame centipawns, the evaluation interpolates
+// between them by the phase of the game
+type Score struct {
+	Middlegame int32 `json:"mg"`
+	Endgame    int32 `json:"eg"`
+}
+
+func (s *Score) add(middlegame int32, endgame int32) {
+	s.Middlegame += middlegame
+	s.Endgame += endgame
+}
+
+// taper interpolates the score by the phase, MAX_PHASE is a pure middlegame and 0 a pure endgame
+func (s Score) taper(phase int32) int32 {
+	return (s.Middlegame*phase + s.Endgame*(MAX_PHASE-phase)) / MAX_PHASE
+}
+
+// Evaluate is the score of the position for the side to move, from the network
+// when one is set, and from the hand crafted evaluation otherwise
 func Evaluate(position *Position) int32 {
+	if CurrentNetwork() != nil {
+		return position.NetworkEvaluate()
+	}
+	return evaluate(position, currentParams(), nil)
+}
+
+// EvaluateWith evaluates the position with the given parameters instead of the active ones
+func EvaluateWith(position *Position, params *EvalParams) int32 {
+	return evaluate(position, params, nil)
+}
+
+// evaluate is the score of the position for the side to move, when the trace is not
+// nil, every term is recorded in it
+func evaluate(position *Position, params *EvalParams, trace *Trace) int32 {
 	board := position.Board
-	p := BlackPawn
-	n := BlackKnight
-	b := BlackBishop
-	r := BlackRook
-	q := BlackQueen
 	turn := position.Turn()
 
-	isEndgame := board.IsEndGame()
+	phase := board.Phase()
 
 	// Compute material balance
 	bbBlackPawn := board.GetBitboardOf(BlackPawn)
@@ -194,8 +236,7 @@ func Evaluate(position *Position) int32 {
 	whiteRooksCount := int32(0)
 	whiteQueensCount := int32(0)
 
-	blackCentipawns := int32(0)
-	whiteCentipawns := int32(0)
+	ev := evaluator{}
 	whites := board.GetWhitePieces()
 	blacks := board.GetBlackPieces()
 	all := whites | blacks
@@ -211,7 +252,7 @@ func Evaluate(position *Position) int32 {
 		blackPawnsCount++
 		// backwards pawn
 		if board.IsBackwardPawn(mask, bbBlackPawn, Black) {
-			blackCentipawns -= 15
+			ev.addScore(Black, BackwardPawns, params.BackwardPawn)
 		}
 		// pawn map
 		sq := Square(index)
@@ -224,11 +265,7 @@ func Evaluate(position *Position) int32 {
 		if rank < blackMostAdvancedPawnsPerFile[file] {
 			blackMostAdvancedPawnsPerFile[file] = rank
 		}
-		if isEndgame {
-			blackCentipawns += latePawnPst[index]
-		} else {
-			blackCentipawns += earlyPawnPst[index]
-		}
+		ev.add(Black, PieceSquares, params.Early.Pawn[index], params.Late.Pawn[index])
 		pieceIter ^= mask
 	}
 
@@ -243,7 +280,7 @@ func Evaluate(position *Position) int32 {
 		mask := uint64(1 << index)
 		// backwards pawn
 		if board.IsBackwardPawn(mask, bbWhitePawn, White) {
-			whiteCentipawns -= 15
+			ev.addScore(White, BackwardPawns, params.BackwardPawn)
 		}
 		// pawn map
 		sq := Square(index)
@@ -256,11 +293,7 @@ func Evaluate(position *Position) int32 {
 		if rank > whiteMostAdvancedPawnsPerFile[file] {
 			whiteMostAdvancedPawnsPerFile[file] = rank
 		}
-		if isEndgame {
-			whiteCentipawns += latePawnPst[flip[index]]
-		} else {
-			whiteCentipawns += earlyPawnPst[flip[index]]
-		}
+		ev.add(White, PieceSquares, params.Early.Pawn[flip[index]], params.Late.Pawn[flip[index]])
 		pieceIter ^= mask
 	}
 
@@ -276,7 +309,7 @@ func Evaluate(position *Position) int32 {
 				isIsolated = true
 			}
 			if isIsolated {
-				whiteCentipawns -= 15
+				ev.addScore(White, IsolatedPawns, params.IsolatedPawn)
 			}
 		}
 
@@ -291,17 +324,17 @@ func Evaluate(position *Position) int32 {
 				isIsolated = true
 			}
 			if isIsolated {
-				blackCentipawns -= 15
+				ev.addScore(Black, IsolatedPawns, params.IsolatedPawn)
 			}
 		}
 
 		// double pawn penalty - black
 		if blackPawnsPerFile[i] > 1 {
-			blackCentipawns -= 15
+			ev.addScore(Black, DoubledPawns, params.DoubledPawn)
 		}
 		// double pawn penalty - white
 		if whitePawnsPerFile[i] > 1 {
-			whiteCentipawns -= 15
+			ev.addScore(White, DoubledPawns, params.DoubledPawn)
 		}
 		// passed and candidate passed pawn award
 		rank := whiteMostAdvancedPawnsPerFile[i]
@@ -309,42 +342,22 @@ func Evaluate(position *Position) int32 {
 			if blackLeastAdvancedPawnsPerFile[i] == Rank8 || blackLeastAdvancedPawnsPerFile[i] < rank { // candidate
 				if i == 0 {
 					if blackLeastAdvancedPawnsPerFile[i+1] == Rank8 || blackLeastAdvancedPawnsPerFile[i+1] < rank { // passed pawn
-						if isEndgame {
-							whiteCentipawns += 50 //passed pawn
-						} else {
-							whiteCentipawns += 20 //passed pawn
-						}
+						ev.addScore(White, PassedPawns, params.PassedPawn) //passed pawn
 					} else {
-						if isEndgame {
-							whiteCentipawns += 25 // candidate passed pawn
-						} else {
-							whiteCentipawns += 10
-						}
+						ev.addScore(White, PassedPawns, params.CandidatePassedPawn) // candidate passed pawn
 					}
 				} else if i == 7 {
 					if blackLeastAdvancedPawnsPerFile[i-1] == Rank8 || blackLeastAdvancedPawnsPerFile[i-1] < rank { // passed pawn
-						if isEndgame {
-							whiteCentipawns += 50 //passed pawn
-						} else {
-							whiteCentipawns += 20
-						}
+						ev.addScore(White, PassedPawns, params.PassedPawn)
 					} else {
-						whiteCentipawns += 25 // candidate passed pawn
+						ev.addScore(White, PassedPawns, params.WhiteHFileCandidatePassedPawn) // candidate passed pawn
 					}
 				} else {
 					if (blackLeastAdvancedPawnsPerFile[i-1] == Rank8 || blackLeastAdvancedPawnsPerFile[i-1] < rank) &&
 						(blackLeastAdvancedPawnsPerFile[i+1] == Rank8 || blackLeastAdvancedPawnsPerFile[i+1] < rank) { // passed pawn
-						if isEndgame {
-							whiteCentipawns += 50 //passed pawn
-						} else {
-							whiteCentipawns += 20 //passed pawn
-						}
+						ev.addScore(White, PassedPawns, params.PassedPawn) //passed pawn
 					} else {
-						if isEndgame {
-							whiteCentipawns += 25 // candidate passed pawn
-						} else {
-							whiteCentipawns += 10 // candidate passed pawn
-						}
+						ev.addScore(White, PassedPawns, params.CandidatePassedPawn) // candidate passed pawn
 					}
 				}
 			}
@@ -355,46 +368,22 @@ func Evaluate(position *Position) int32 {
 			if whiteLeastAdvancedPawnsPerFile[i] == Rank1 || whiteLeastAdvancedPawnsPerFile[i] > rank { // candidate
 				if i == 0 {
 					if whiteLeastAdvancedPawnsPerFile[i+1] == Rank1 || whiteLeastAdvancedPawnsPerFile[i+1] > rank { // passed pawn
-						if isEndgame {
-							blackCentipawns += 50 //passed pawn
-						} else {
-							blackCentipawns += 20 //passed pawn
-						}
+						ev.addScore(Black, PassedPawns, params.PassedPawn) //passed pawn
 					} else {
-						if isEndgame {
-							blackCentipawns += 25 // candidate passed pawn
-						} else {
-							blackCentipawns += 10 // candidate passed pawn
-						}
+						ev.addScore(Black, PassedPawns, params.CandidatePassedPawn) // candidate passed pawn
 					}
 				} else if i == 7 {
 					if whiteLeastAdvancedPawnsPerFile[i-1] == Rank1 || whiteLeastAdvancedPawnsPerFile[i-1] > rank { // passed pawn
-						if isEndgame {
-							blackCentipawns += 50 //passed pawn
-						} else {
-							blackCentipawns += 20 //passed pawn
-						}
+						ev.addScore(Black, PassedPawns, params.PassedPawn) //passed pawn
 					} else {
-						if isEndgame {
-							blackCentipawns += 25 // candidate passed pawn
-						} else {
-							blackCentipawns += 10 // candidate passed pawn
-						}
+						ev.addScore(Black, PassedPawns, params.CandidatePassedPawn) // candidate passed pawn
 					}
 				} else {
 					if (whiteLeastAdvancedPawnsPerFile[i-1] == Rank1 || whiteLeastAdvancedPawnsPerFile[i-1] > rank) &&
 						(whiteLeastAdvancedPawnsPerFile[i+1] == Rank1 || whiteLeastAdvancedPawnsPerFile[i+1] > rank) { // passed pawn
-						if isEndgame {
-							blackCentipawns += 50 //passed pawn
-						} else {
-							blackCentipawns += 20 //passed pawn
-						}
+						ev.addScore(Black, PassedPawns, params.PassedPawn) //passed pawn
 					} else {
-						if isEndgame {
-							blackCentipawns += 25 // candidate passed pawn
-						} else {
-							blackCentipawns += 10 // candidate passed pawn
-						}
+						ev.addScore(Black, PassedPawns, params.CandidatePassedPawn) // candidate passed pawn
 					}
 				}
 			}
@@ -407,11 +396,7 @@ func Evaluate(position *Position) int32 {
 		blackKnightsCount++
 		index := bits.TrailingZeros64(pieceIter)
 		mask := uint64(1 << index)
-		if isEndgame {
-			blackCentipawns += lateKnightPst[index]
-		} else {
-			blackCentipawns += earlyKnightPst[index]
-		}
+		ev.add(Black, PieceSquares, params.Early.Knight[index], params.Late.Knight[index])
 		pieceIter ^= mask
 	}
 
@@ -420,11 +405,7 @@ func Evaluate(position *Position) int32 {
 		blackBishopsCount++
 		index := bits.TrailingZeros64(pieceIter)
 		mask := uint64(1 << index)
-		if isEndgame {
-			blackCentipawns += lateBishopPst[index]
-		} else {
-			blackCentipawns += earlyBishopPst[index]
-		}
+		ev.add(Black, PieceSquares, params.Early.Bishop[index], params.Late.Bishop[index])
 		pieceIter ^= mask
 	}
 
@@ -436,24 +417,20 @@ func Evaluate(position *Position) int32 {
 		file := Square(index).File()
 		if blackPawnsPerFile[file] == 0 {
 			if whitePawnsPerFile[file] == 0 { // open file
-				blackCentipawns += 25
+				ev.addScore(Black, RookFiles, params.RookOpenFile)
 			} else { // semi-open file
-				blackCentipawns += 15
+				ev.addScore(Black, RookFiles, params.RookSemiOpenFile)
 			}
 		}
 		sq := Square(index)
 		if board.IsVerticalDoubleRook(sq, bbBlackRook, all) {
 			// double-rook vertical
-			blackCentipawns += 25
+			ev.addScore(Black, DoubledRooks, params.VerticalDoubledRooks)
 		} else if board.IsHorizontalDoubleRook(sq, bbBlackRook, all) {
 			// double-rook horizontal
-			blackCentipawns += 15
-		}
-		if isEndgame {
-			blackCentipawns += lateRookPst[index]
-		} else {
-			blackCentipawns += earlyRookPst[index]
+			ev.addScore(Black, DoubledRooks, params.HorizontalDoubledRooks)
 		}
+		ev.add(Black, PieceSquares, params.Early.Rook[index], params.Late.Rook[index])
 		pieceIter ^= mask
 	}
 
@@ -462,11 +439,7 @@ func Evaluate(position *Position) int32 {
 		blackQueensCount++
 		index := bits.TrailingZeros64(pieceIter)
 		mask := uint64(1 << index)
-		if isEndgame {
-			blackCentipawns += lateQueenPst[index]
-		} else {
-			blackCentipawns += earlyQueenPst[index]
-		}
+		ev.add(Black, PieceSquares, params.Early.Queen[index], params.Late.Queen[index])
 		pieceIter ^= mask
 	}
 
@@ -474,18 +447,13 @@ func Evaluate(position *Position) int32 {
 	for pieceIter != 0 {
 		index := bits.TrailingZeros64(pieceIter)
 		mask := uint64(1 << index)
-		if isEndgame {
-			blackCentipawns += lateKingPst[index]
-		} else {
-			award := earlyKingPst[index]
-			if award <= 0 {
-				if !position.HasTag(BlackCanCastleKingSide) {
-					award -= 10
-				} else if !position.HasTag(BlackCanCastleQueenSide) {
-					award -= 10
-				}
+		ev.add(Black, PieceSquares, params.Early.King[index], params.Late.King[index])
+		if params.Early.King[index] <= 0 {
+			if !position.HasTag(BlackCanCastleKingSide) {
+				ev.addScore(Black, Castling, params.LostCastling)
+			} else if !position.HasTag(BlackCanCastleQueenSide) {
+				ev.addScore(Black, Castling, params.LostCastling)
 			}
-			blackCentipawns += award
 		}
 		pieceIter ^= mask
 	}
@@ -496,11 +464,7 @@ func Evaluate(position *Position) int32 {
 		whiteKnightsCount++
 		index := bits.TrailingZeros64(pieceIter)
 		mask := uint64(1 << index)
-		if isEndgame {
-			whiteCentipawns += lateKnightPst[flip[index]]
-		} else {
-			whiteCentipawns += earlyKnightPst[flip[index]]
-		}
+		ev.add(White, PieceSquares, params.Early.Knight[flip[index]], params.Late.Knight[flip[index]])
 		pieceIter ^= mask
 	}
 
@@ -509,11 +473,7 @@ func Evaluate(position *Position) int32 {
 		whiteBishopsCount++
 		index := bits.TrailingZeros64(pieceIter)
 		mask := uint64(1 << index)
-		if isEndgame {
-			whiteCentipawns += lateBishopPst[flip[index]]
-		} else {
-			whiteCentipawns += earlyBishopPst[flip[index]]
-		}
+		ev.add(White, PieceSquares, params.Early.Bishop[flip[index]], params.Late.Bishop[flip[index]])
 		pieceIter ^= mask
 	}
 
@@ -525,24 +485,20 @@ func Evaluate(position *Position) int32 {
 		file := Square(index).File()
 		if whitePawnsPerFile[file] == 0 {
 			if blackPawnsPerFile[file] == 0 { // open file
-				whiteCentipawns += 25
+				ev.addScore(White, RookFiles, params.RookOpenFile)
 			} else { // semi-open file
-				whiteCentipawns += 15
+				ev.addScore(White, RookFiles, params.RookSemiOpenFile)
 			}
 		}
 		sq := Square(index)
 		if board.IsVerticalDoubleRook(sq, bbWhiteRook, all) {
 			// double-rook vertical
-			whiteCentipawns += 25
+			ev.addScore(White, DoubledRooks, params.VerticalDoubledRooks)
 		} else if board.IsHorizontalDoubleRook(sq, bbWhiteRook, all) {
 			// double-rook horizontal
-			whiteCentipawns += 15
-		}
-		if isEndgame {
-			whiteCentipawns += lateRookPst[flip[index]]
-		} else {
-			whiteCentipawns += earlyRookPst[flip[index]]
+			ev.addScore(White, DoubledRooks, params.HorizontalDoubledRooks)
 		}
+		ev.add(White, PieceSquares, params.Early.Rook[flip[index]], params.Late.Rook[flip[index]])
 		pieceIter ^= mask
 	}
 
@@ -551,11 +507,7 @@ func Evaluate(position *Position) int32 {
 		whiteQueensCount++
 		index := bits.TrailingZeros64(pieceIter)
 		mask := uint64(1 << index)
-		if isEndgame {
-			whiteCentipawns += lateQueenPst[flip[index]]
-		} else {
-			whiteCentipawns += earlyQueenPst[flip[index]]
-		}
+		ev.add(White, PieceSquares, params.Early.Queen[flip[index]], params.Late.Queen[flip[index]])
 		pieceIter ^= mask
 	}
 
@@ -563,40 +515,26 @@ func Evaluate(position *Position) int32 {
 	for pieceIter != 0 {
 		index := bits.TrailingZeros64(pieceIter)
 		mask := uint64(1 << index)
-		if isEndgame {
-			whiteCentipawns += lateKingPst[flip[index]]
-		} else {
-			award := earlyKingPst[flip[index]]
-			if award <= 0 {
-				if !position.HasTag(WhiteCanCastleKingSide) {
-					award -= 10
-				} else if !position.HasTag(WhiteCanCastleQueenSide) {
-					award -= 10
-				}
+		ev.add(White, PieceSquares, params.Early.King[flip[index]], params.Late.King[flip[index]])
+		if params.Early.King[flip[index]] <= 0 {
+			if !position.HasTag(WhiteCanCastleKingSide) {
+				ev.addScore(White, Castling, params.LostCastling)
+			} else if !position.HasTag(WhiteCanCastleQueenSide) {
+				ev.addScore(White, Castling, params.LostCastling)
 			}
-			whiteCentipawns += award
 		}
 		pieceIter ^= mask
 	}
 
-	blackCentipawns += blackPawnsCount * p.Weight()
-	blackCentipawns += blackKnightsCount * n.Weight()
-	blackCentipawns += blackBishopsCount * b.Weight()
-	blackCentipawns += blackRooksCount * r.Weight()
-	blackCentipawns += blackQueensCount * q.Weight()
-
-	whiteCentipawns += whitePawnsCount * p.Weight()
-	whiteCentipawns += whiteKnightsCount * n.Weight()
-	whiteCentipawns += whiteBishopsCount * b.Weight()
-	whiteCentipawns += whiteRooksCount * r.Weight()
-	whiteCentipawns += whiteQueensCount * q.Weight()
+	ev.addMaterial(Black, params, blackPawnsCount, blackKnightsCount, blackBishopsCount, blackRooksCount, blackQueensCount)
+	ev.addMaterial(White, params, whitePawnsCount, whiteKnightsCount, whiteBishopsCount, whiteRooksCount, whiteQueensCount)
 
 	// 2 Bishops vs 2 Knights
 	if whiteBishopsCount >= 2 && blackBishopsCount < 2 {
-		whiteCentipawns += 25
+		ev.addScore(White, BishopPair, params.BishopPair)
 	}
 	if whiteBishopsCount < 2 && blackBishopsCount >= 2 {
-		blackCentipawns += 25
+		ev.addScore(Black, BishopPair, params.BishopPair)
 	}
 
 	// mobility and attacks
@@ -608,19 +546,138 @@ func Evaluate(position *Position) int32 {
 	whiteAggressivity := bits.OnesCount64(whiteAttacks >> 32) // keep hi-bits only (black's half)
 	blackAggressivity := bits.OnesCount64(blackAttacks << 32) // keep lo-bits only (white's half)
 
-	aggressivityFactor := int32(1)
-	if !isEndgame {
-		aggressivityFactor = 2
-	}
-	whiteCentipawns += aggressivityFactor * int32(wAttackCounts-bAttackCounts)
-	blackCentipawns += aggressivityFactor * int32(bAttackCounts-wAttackCounts)
+	mobility := int32(wAttackCounts - bAttackCounts)
+	ev.addScaled(White, Mobility, params.Mobility, mobility)
+	ev.addScaled(Black, Mobility, params.Mobility, -mobility)
+
+	aggressivity := int32(whiteAggressivity - blackAggressivity)
+	ev.addScaled(White, Aggressivity, params.Aggressivity, aggressivity)
+	ev.addScaled(Black, Aggressivity, params.Aggressivity, -aggressivity)
 
-	whiteCentipawns += aggressivityFactor * int32(2*(whiteAggressivity-blackAggressivity))
-	blackCentipawns += aggressivityFactor * int32(2*(blackAggressivity-whiteAggressivity))
+	kingSafety(&ev, &board, params, White, whiteAttacks)
+	kingSafety(&ev, &board, params, Black, blackAttacks)
 
+	score := ev.score()
+	if trace != nil {
+		ev.fillTrace(trace)
+		trace.Phase = phase
+		trace.Score = score.taper(phase)
+	}
 	if turn == White {
-		return whiteCentipawns - blackCentipawns
+		return score.taper(phase)
 	} else {
-		return blackCentipawns - whiteCentipawns
+		return -score.taper(phase)
+	}
+}
+
+const fileA = uint64(0x0101010101010101)
+
+// kingSafety scores the pawns that shelter the king of the color, the files around it,
+// and the attack of the opponent on it. Defended are the squares the color attacks
+func kingSafety(ev *evaluator, board *Bitboard, params *EvalParams, us Color, defended uint64) {
+	them := us.Other()
+	king := board.GetBitboardOf(GetPiece(King, us))
+	if king == 0 {
+		return
+	}
+	ourPawns := board.GetBitboardOf(GetPiece(Pawn, us))
+	theirPawns := board.GetBitboardOf(GetPiece(Pawn, them))
+	sq := Square(bits.TrailingZeros64(king))
+	rank := int(sq.Rank())
+
+	// The squares in front of the king, and the pawns on them closest to the king
+	var front uint64
+	closest := func(pawns uint64) int {
+		if us == White {
+			return bits.TrailingZeros64(pawns)/8 - rank
+		}
+		return rank - (63-bits.LeadingZeros64(pawns))/8
+	}
+	if us == White {
+		front = ^uint64(0) << uint(8*(rank+1))
+	} else {
+		front = uint64(1)<<uint(8*rank) - 1
+	}
+
+	kingFile := int(sq.File())
+	for file := kingFile - 1; file <= kingFile+1; file++ {
+		if file < 0 || file > 7 {
+			continue
+		}
+		fileMask := fileA << uint(file)
+		ours := ourPawns & fileMask
+		theirs := theirPawns & fileMask
+		if ours == 0 {
+			if theirs == 0 {
+				ev.addScore(us, KingShelter, params.KingOpenFile)
+			} else {
+				ev.addScore(us, KingShelter, params.KingSemiOpenFile)
+			}
+		}
+		if shield := ours & front; shield != 0 {
+			switch closest(shield) {
+			case 1:
+				ev.addScore(us, KingShelter, params.PawnShield)
+			case 2:
+				ev.addScore(us, KingShelter, params.AdvancedPawnShield)
+			}
+		}
+		if storm := theirs & front; storm != 0 && closest(storm) <= 3 {
+			ev.addScore(us, KingShelter, params.PawnStorm)
+		}
+	}
+
+	// The pieces of the opponent that attack the squares around the king, and the
+	// checks they can give on squares that are not defended. Without a queen the
+	// attack is not dangerous
+	queens := board.GetBitboardOf(GetPiece(Queen, them))
+	if queens == 0 {
+		return
+	}
+	occupied := board.GetWhitePieces() | board.GetBlackPieces()
+	theirPieces := board.GetBlackPieces()
+	if them == White {
+		theirPieces = board.GetWhitePieces()
+	}
+	zone := KingZone(sq, us)
+	safe := ^(defended | theirPieces)
+	knightChecks := KnightAttacksFrom(sq) & safe
+	bishopChecks := BishopAttacksFrom(sq, occupied) & safe
+	rookChecks := RookAttacksFrom(sq, occupied) & safe
+
+	attackers := 0
+	units := int32(0)
+	attack := func(attacks uint64, weight int32, checks uint64, checkWeight int32) {
+		if attacked := bits.OnesCount64(attacks & zone); attacked > 0 {
+			attackers++
+			units += weight * int32(attacked)
+		}
+		units += checkWeight * int32(bits.OnesCount64(attacks&checks))
+	}
+
+	for pieces := board.GetBitboardOf(GetPiece(Knight, them)); pieces != 0; pieces &= pieces - 1 {
+		attack(KnightAttacksFrom(Square(bits.TrailingZeros64(pieces))), params.KnightAttackWeight,
+			knightChecks, params.KnightSafeCheck)
+	}
+	for pieces := board.GetBitboardOf(GetPiece(Bishop, them)); pieces != 0; pieces &= pieces - 1 {
+		attack(BishopAttacksFrom(Square(bits.TrailingZeros64(pieces)), occupied), params.BishopAttackWeight,
+			bishopChecks, params.BishopSafeCheck)
+	}
+	for pieces := board.GetBitboardOf(GetPiece(Rook, them)); pieces != 0; pieces &= pieces - 1 {
+		attack(RookAttacksFrom(Square(bits.TrailingZeros64(pieces)), occupied), params.RookAttackWeight,
+			rookChecks, params.RookSafeCheck)
+	}
+	for pieces := queens; pieces != 0; pieces &= pieces - 1 {
+		attack(QueenAttacksFrom(Square(bits.TrailingZeros64(pieces)), occupied), params.QueenAttackWeight,
+			bishopChecks|rookChecks, params.QueenSafeCheck)
+	}
+
+	if attackers >= 2 {
+		if units >= KING_DANGER_UNITS {
+			units = KING_DANGER_UNITS - 1
+		} else if units < 0 {
+			units = 0
+		}
+		ev.add(us, KingAttack, -params.KingDanger[units], 0)
 	}
 }
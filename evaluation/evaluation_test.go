@@ -1,7 +1,15 @@
 package evaluation
 
 import (
+	"compress/gzip"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	. "github.com/amanjpro/zahak/engine"
@@ -99,7 +107,7 @@ func TestRookStructureEval(t *testing.T) {
 	game := FromFen(fen, false)
 
 	actual := Evaluate(game.Position())
-	expected := int32(37)
+	expected := int32(39)
 
 	if actual != expected {
 		err := fmt.Sprintf("Semi-open file - White:\nExpected: %d\nGot: %d\n", expected, actual)
@@ -110,10 +118,244 @@ func TestRookStructureEval(t *testing.T) {
 	game = FromFen(fen, false)
 
 	actual = Evaluate(game.Position())
-	expected = int32(37)
+	expected = int32(39)
 
 	if actual != expected {
 		err := fmt.Sprintf("Semi-open file - Black:\nExpected: %d\nGot: %d\n", expected, actual)
 		t.Errorf(err)
 	}
 }
+
+func TestTaperedScore(t *testing.T) {
+	score := Score{100, 20}
+	if actual := score.taper(MAX_PHASE); actual != 100 {
+		t.Errorf("Expected the middlegame score in the opening, got: %d", actual)
+	}
+	if actual := score.taper(0); actual != 20 {
+		t.Errorf("Expected the endgame score without pieces, got: %d", actual)
+	}
+	if actual := score.taper(MAX_PHASE / 2); actual != 60 {
+		t.Errorf("Expected the average score in between, got: %d", actual)
+	}
+}
+
+func TestWDLModel(t *testing.T) {
+	model := DefaultWDLModel
+	for _, phase := range []int32{0, 12, MAX_PHASE} {
+		wdl := model.WDL(0, phase)
+		if wdl.Win+wdl.Draw+wdl.Loss != 1000 || wdl.Win != wdl.Loss {
+			t.Errorf("Expected an even score to be balanced, got: %v", wdl)
+		}
+		a, _ := model.params(phase)
+		score := int32(math.Round(a))
+		if normalized := model.Normalize(score, phase); normalized != 100 {
+			t.Errorf("Expected the score that wins half of the games to be 100, got: %d", normalized)
+		}
+		if win := model.WinRate(score, phase); math.Abs(win-0.5) > 0.01 {
+			t.Errorf("Expected a normalized 100 to win half of the games, got: %f", win)
+		}
+	}
+	if wdl := model.WDL(CHECKMATE_EVAL, 0); wdl.Win != 1000 {
+		t.Errorf("Expected a mate to always win, got: %v", wdl)
+	}
+}
+
+func TestFitWDLModel(t *testing.T) {
+	expected := WDLModel{250, 150, 90, 60}
+	random := rand.New(rand.NewSource(1))
+	samples := make([]WDLSample, 20000)
+	for i := range samples {
+		score := int32(random.Intn(1200) - 600)
+		phase := int32(random.Intn(int(MAX_PHASE) + 1))
+		win := expected.WinRate(score, phase)
+		loss := expected.WinRate(-score, phase)
+		outcome := int8(0)
+		if r := random.Float64(); r < win {
+			outcome = 1
+		} else if r < win+loss {
+			outcome = -1
+		}
+		samples[i] = WDLSample{score, phase, outcome}
+	}
+	fitted := FitWDLModel(samples, DefaultWDLModel)
+	for i := 0; i < 4; i++ {
+		if actual, want := *fitted.param(i), *expected.param(i); math.Abs(actual-want) > want/5 {
+			t.Errorf("Expected the parameter %d to be about %f, got: %f", i, want, actual)
+		}
+	}
+}
+
+func TestDefaultWDLModelWinsHalfOfTheGamesAtANormalizedHundred(t *testing.T) {
+	for phase := int32(0); phase <= MAX_PHASE; phase++ {
+		score := int32(0)
+		for DefaultWDLModel.Normalize(score, phase) < 100 {
+			score++
+		}
+		if win := DefaultWDLModel.WinRate(score, phase); math.Abs(win-0.5) > 0.02 {
+			t.Errorf("Expected %d, a normalized 100, to win half of the games at phase %d, got: %f", score, phase, win)
+		}
+	}
+}
+
+func TestReadWDLSamples(t *testing.T) {
+	data := `rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1 [1.0] 35 20 e2e4
+4k3/8/8/8/8/8/8/4K3 b - - 0 1 [0.5] 0
+
+4k3/8/8/8/8/8/8/R3K3 w - - 0 1 [0.0] -20`
+	samples, err := ReadWDLSamples(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []WDLSample{{35, MAX_PHASE, 1}, {0, 0, 0}, {-20, 2, -1}}
+	if fmt.Sprint(samples) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got: %v", expected, samples)
+	}
+	if _, err := ReadWDLSamples(strings.NewReader("4k3/8/8/8/8/8/8/4K3 b - - 0 1 1-0 0")); err == nil {
+		t.Errorf("Expected an unknown result to be an error")
+	}
+}
+
+func TestDefaultWDLModelIsFittedToTheSelfPlayData(t *testing.T) {
+	if testing.Short() {
+		t.Skip("fitting the model takes a few seconds")
+	}
+	file, err := os.Open("testdata/selfplay-positions.txt.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples, err := ReadWDLSamples(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fitted := FitWDLModel(samples, DefaultWDLModel)
+	for i := 0; i < 4; i++ {
+		if actual, want := *fitted.param(i), *DefaultWDLModel.param(i); math.Abs(actual-want) > 1 {
+			t.Errorf("Expected the parameter %d to be %f, as it is fitted to, got: %f", i, want, actual)
+		}
+	}
+}
+
+func TestEvaluateTrace(t *testing.T) {
+	game := FromFen("r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 b - - 0 10", true)
+	trace := EvaluateTrace(game.Position())
+	if trace.Score != -Evaluate(game.Position()) {
+		t.Errorf("Expected the trace to agree with the evaluation, got %d and %d", trace.Score, Evaluate(game.Position()))
+	}
+	total := Score{}
+	for _, term := range trace.Terms {
+		total.add(term.Total().Middlegame, term.Total().Endgame)
+	}
+	if total.taper(trace.Phase) != trace.Score {
+		t.Errorf("Expected the terms to add up to %d, got: %d", trace.Score, total.taper(trace.Phase))
+	}
+	if material := trace.Terms[Material]; material.White.Middlegame != 3900 || material.Total().Middlegame != 0 {
+		t.Errorf("Expected balanced material, got: %v", material)
+	}
+
+	data, err := json.Marshal(trace)
+	if err != nil {
+		t.Fatalf("Could not marshal the trace: %s", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil || len(decoded["terms"].([]interface{})) != int(NUMBER_OF_TERMS) {
+		t.Errorf("Expected every term in the JSON, got: %s", data)
+	}
+	if !strings.Contains(trace.String(), "Bishop pair") {
+		t.Errorf("Expected every term in the table, got:\n%s", trace)
+	}
+}
+
+func TestKingSafety(t *testing.T) {
+	params := DefaultEvalParams()
+
+	shelter := func(fen string, color Color) int32 {
+		game := FromFen(fen, true)
+		trace := EvaluateTrace(game.Position())
+		if color == White {
+			return trace.Terms[KingShelter].White.Middlegame
+		}
+		return trace.Terms[KingShelter].Black.Middlegame
+	}
+	if actual := shelter("6k1/5ppp/8/8/8/8/5PPP/6K1 w - - 0 1", White); actual != 3*params.PawnShield.Middlegame {
+		t.Errorf("Expected a full pawn shield, got: %d", actual)
+	}
+	if actual := shelter("6k1/8/8/8/8/8/8/6K1 w - - 0 1", Black); actual != 3*params.KingOpenFile.Middlegame {
+		t.Errorf("Expected three open files, got: %d", actual)
+	}
+	expected := params.PawnShield.Middlegame + params.AdvancedPawnShield.Middlegame +
+		params.PawnStorm.Middlegame + params.KingSemiOpenFile.Middlegame
+	if actual := shelter("6k1/5p1p/8/8/6p1/6P1/5P2/6K1 w - - 0 1", White); actual != expected {
+		t.Errorf("Expected %d for the shelter, got: %d", expected, actual)
+	}
+
+	attack := func(fen string) TermTrace {
+		game := FromFen(fen, true)
+		return EvaluateTrace(game.Position()).Terms[KingAttack]
+	}
+	// The queen and the knight attack the squares in front of the king
+	if actual := attack("6k1/5ppp/8/4n3/7q/8/5PPP/6K1 w - - 0 1"); actual.White.Middlegame >= 0 || actual.Black.Middlegame != 0 {
+		t.Errorf("Expected the white king to be in danger, got: %v", actual)
+	}
+	// Without the queen, the attack is not dangerous
+	if actual := attack("6k1/5ppp/8/4n3/7r/8/5PPP/6K1 w - - 0 1"); actual.White.Middlegame != 0 {
+		t.Errorf("Expected no danger without the queen, got: %v", actual)
+	}
+	// A single attacker is not enough either
+	if actual := attack("6k1/5ppp/8/8/7q/8/5PPP/6K1 w - - 0 1"); actual.White.Middlegame != 0 {
+		t.Errorf("Expected no danger from a lonely queen, got: %v", actual)
+	}
+}
+
+func TestEvalParamsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "params.json")
+	params := DefaultEvalParams()
+	params.BishopPair = Score{40, 60}
+	params.Late.King[0] = -70
+	if err := params.Save(path); err != nil {
+		t.Fatalf("Could not save the parameters: %s", err)
+	}
+	loaded, err := LoadEvalParams(path)
+	if err != nil || loaded != params {
+		t.Errorf("Expected the saved parameters to be loaded, got: %v", err)
+	}
+
+	partial := filepath.Join(t.TempDir(), "partial.json")
+	ioutil.WriteFile(partial, []byte(`{"BishopPair": {"mg": 50, "eg": 50}}`), 0644)
+	loaded, err = LoadEvalParams(partial)
+	expected := DefaultEvalParams()
+	expected.BishopPair = Score{50, 50}
+	if err != nil || loaded != expected {
+		t.Errorf("Expected the missing parameters to keep their defaults, got: %v", err)
+	}
+
+	game := FromFen("4k3/8/8/8/8/8/8/2B1KB2 w - - 0 1", true)
+	before := Evaluate(game.Position())
+	SetEvalParams(expected)
+	defer SetEvalParams(DefaultEvalParams())
+	if after := Evaluate(game.Position()); after != before+25 {
+		t.Errorf("Expected the bishop pair to be worth 25 more, got: %d and %d", before, after)
+	}
+}
+
+func TestEvalParamsCanBeSetWhileEvaluating(t *testing.T) {
+	game := FromFen("r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 b - - 0 10", true)
+	params := DefaultEvalParams()
+	params.BishopPair = Score{50, 50}
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 1000; i++ {
+			Evaluate(game.Position())
+		}
+		done <- true
+	}()
+	for i := 0; i < 1000; i++ {
+		SetEvalParams(params)
+		SetEvalParams(DefaultEvalParams())
+	}
+	<-done
+}
@@ -0,0 +1,208 @@
+package evaluation
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// PieceSquareTables are the bonuses of every piece by square, from black's side of the board
+type PieceSquareTables struct {
+	Pawn   [64]int32
+	Knight [64]int32
+	Bishop [64]int32
+	Rook   [64]int32
+	Queen  [64]int32
+	King   [64]int32
+}
+
+// EvalParams are the weights of the evaluation terms, penalties are negative
+type EvalParams struct {
+	Pawn   Score
+	Knight Score
+	Bishop Score
+	Rook   Score
+	Queen  Score
+
+	Early PieceSquareTables
+	Late  PieceSquareTables
+
+	BackwardPawn                  Score
+	IsolatedPawn                  Score
+	DoubledPawn                   Score
+	PassedPawn                    Score
+	CandidatePassedPawn           Score
+	WhiteHFileCandidatePassedPawn Score // Only white's candidates on the h-file, black's get CandidatePassedPawn
+	RookOpenFile                  Score
+	RookSemiOpenFile              Score
+	VerticalDoubledRooks          Score
+	HorizontalDoubledRooks        Score
+	BishopPair                    Score
+	LostCastling                  Score // When the king is not on a good square and cannot castle anymore
+	Mobility                      Score // For every square attacked more than the opponent
+	Aggressivity                  Score // For every square attacked in the opponent's half, more than the opponent
+
+	PawnShield         Score // For every pawn right in front of the king, on its file and the adjacent ones
+	AdvancedPawnShield Score // For every such pawn, two squares in front of the king
+	PawnStorm          Score // For every opponent pawn on these files, at most three squares in front of the king
+	KingOpenFile       Score // For every one of these files without pawns
+	KingSemiOpenFile   Score // For every one of these files with the opponent's pawns only
+
+	// The attack units of the pieces attacking the king zone, for every square of it they attack
+	KnightAttackWeight int32
+	BishopAttackWeight int32
+	RookAttackWeight   int32
+	QueenAttackWeight  int32
+	// The attack units of the safe checks of the opponent, by the piece that gives them
+	KnightSafeCheck int32
+	BishopSafeCheck int32
+	RookSafeCheck   int32
+	QueenSafeCheck  int32
+	// The middlegame penalty by the attack units, used when at least two pieces attack
+	// the king zone and the opponent has a queen
+	KingDanger [KING_DANGER_UNITS]int32
+}
+
+const KING_DANGER_UNITS = 100
+
+func DefaultEvalParams() EvalParams {
+	return EvalParams{
+		Pawn:   Score{100, 100},
+		Knight: Score{300, 300},
+		Bishop: Score{300, 300},
+		Rook:   Score{500, 500},
+		Queen:  Score{900, 900},
+
+		Early: PieceSquareTables{defaultEarlyPawnPst, defaultEarlyKnightPst, defaultEarlyBishopPst,
+			defaultEarlyRookPst, defaultEarlyQueenPst, defaultEarlyKingPst},
+		Late: PieceSquareTables{defaultLatePawnPst, defaultLateKnightPst, defaultLateBishopPst,
+			defaultLateRookPst, defaultLateQueenPst, defaultLateKingPst},
+
+		BackwardPawn:                  Score{-15, -15},
+		IsolatedPawn:                  Score{-15, -15},
+		DoubledPawn:                   Score{-15, -15},
+		PassedPawn:                    Score{20, 50},
+		CandidatePassedPawn:           Score{10, 25},
+		WhiteHFileCandidatePassedPawn: Score{25, 25},
+		RookOpenFile:                  Score{25, 25},
+		RookSemiOpenFile:              Score{15, 15},
+		VerticalDoubledRooks:          Score{25, 25},
+		HorizontalDoubledRooks:        Score{15, 15},
+		BishopPair:                    Score{25, 25},
+		LostCastling:                  Score{-10, 0},
+		Mobility:                      Score{2, 1},
+		Aggressivity:                  Score{4, 2},
+
+		PawnShield:         Score{15, 0},
+		AdvancedPawnShield: Score{8, 0},
+		PawnStorm:          Score{-10, 0},
+		KingOpenFile:       Score{-25, 0},
+		KingSemiOpenFile:   Score{-12, 0},
+
+		KnightAttackWeight: 2,
+		BishopAttackWeight: 2,
+		RookAttackWeight:   3,
+		QueenAttackWeight:  5,
+		KnightSafeCheck:    3,
+		BishopSafeCheck:    2,
+		RookSafeCheck:      4,
+		QueenSafeCheck:     4,
+		KingDanger:         defaultKingDanger,
+	}
+}
+
+// The parameters Evaluate uses, holding a *EvalParams. They can be replaced while
+// a search is running, every evaluation then sees either the old or the new ones
+var activeParams = func() *atomic.Value {
+	value := &atomic.Value{}
+	params := DefaultEvalParams()
+	value.Store(&params)
+	return value
+}()
+
+func SetEvalParams(params EvalParams) {
+	activeParams.Store(&params)
+}
+
+func CurrentEvalParams() EvalParams {
+	return *currentParams()
+}
+
+func currentParams() *EvalParams {
+	return activeParams.Load().(*EvalParams)
+}
+
+// LoadEvalParams reads the parameters from a JSON file, the parameters that
+// are missing from the file keep their default values
+func LoadEvalParams(path string) (EvalParams, error) {
+	params := DefaultEvalParams()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return params, err
+	}
+	err = json.Unmarshal(data, &params)
+	return params, err
+}
+
+func (p EvalParams) Save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, compactTables(data), 0644)
+}
+
+var numberArray = regexp.MustCompile(`\[[\s\d,-]+\]`)
+
+// compactTables prints the piece square tables as rows of 8 squares, like a board
+func compactTables(data []byte) []byte {
+	return numberArray.ReplaceAllFunc(data, func(array []byte) []byte {
+		numbers := strings.Fields(strings.NewReplacer("[", "", "]", "", ",", " ").Replace(string(array)))
+		var buffer bytes.Buffer
+		buffer.WriteString("[")
+		for i, number := range numbers {
+			if i%8 == 0 {
+				buffer.WriteString("\n      ")
+			} else {
+				buffer.WriteString(" ")
+			}
+			buffer.WriteString(number)
+			if i != len(numbers)-1 {
+				buffer.WriteString(",")
+			}
+		}
+		buffer.WriteString("\n    ]")
+		return buffer.Bytes()
+	})
+}
+
+// Weights are pointers to every weight of the parameters, for the tuners to change them one by one
+func (p *EvalParams) Weights() []*int32 {
+	scores := []*Score{&p.Pawn, &p.Knight, &p.Bishop, &p.Rook, &p.Queen,
+		&p.BackwardPawn, &p.IsolatedPawn, &p.DoubledPawn, &p.PassedPawn, &p.CandidatePassedPawn,
+		&p.WhiteHFileCandidatePassedPawn,
+		&p.RookOpenFile, &p.RookSemiOpenFile, &p.VerticalDoubledRooks, &p.HorizontalDoubledRooks,
+		&p.BishopPair, &p.LostCastling, &p.Mobility, &p.Aggressivity,
+		&p.PawnShield, &p.AdvancedPawnShield, &p.PawnStorm, &p.KingOpenFile, &p.KingSemiOpenFile}
+	tables := []*[64]int32{&p.Early.Pawn, &p.Early.Knight, &p.Early.Bishop, &p.Early.Rook, &p.Early.Queen, &p.Early.King,
+		&p.Late.Pawn, &p.Late.Knight, &p.Late.Bishop, &p.Late.Rook, &p.Late.Queen, &p.Late.King}
+
+	weights := make([]*int32, 0, 2*len(scores)+64*len(tables)+8+KING_DANGER_UNITS)
+	for _, score := range scores {
+		weights = append(weights, &score.Middlegame, &score.Endgame)
+	}
+	weights = append(weights, &p.KnightAttackWeight, &p.BishopAttackWeight, &p.RookAttackWeight, &p.QueenAttackWeight,
+		&p.KnightSafeCheck, &p.BishopSafeCheck, &p.RookSafeCheck, &p.QueenSafeCheck)
+	for i := range p.KingDanger {
+		weights = append(weights, &p.KingDanger[i])
+	}
+	for _, table := range tables {
+		for sq := range table {
+			weights = append(weights, &table[sq])
+		}
+	}
+	return weights
+}
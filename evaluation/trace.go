@@ -0,0 +1,160 @@
+package evaluation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	. "github.com/amanjpro/zahak/engine"
+)
+
+// Term is one of the parts the evaluation is made of
+type Term int8
+
+const (
+	Material Term = iota
+	PieceSquares
+	BackwardPawns
+	IsolatedPawns
+	DoubledPawns
+	PassedPawns
+	RookFiles
+	DoubledRooks
+	BishopPair
+	Castling
+	Mobility
+	Aggressivity
+	KingShelter
+	KingAttack
+	NUMBER_OF_TERMS
+)
+
+var termNames = [NUMBER_OF_TERMS]string{
+	"Material",
+	"Piece squares",
+	"Backward pawns",
+	"Isolated pawns",
+	"Doubled pawns",
+	"Passed pawns",
+	"Rook files",
+	"Doubled rooks",
+	"Bishop pair",
+	"Castling",
+	"Mobility",
+	"Aggressivity",
+	"King shelter",
+	"King attack",
+}
+
+func (t Term) String() string {
+	return termNames[t]
+}
+
+// TermTrace is the contribution of a term for each side
+type TermTrace struct {
+	White Score
+	Black Score
+}
+
+// Total is the contribution of the term from white's point of view
+func (t TermTrace) Total() Score {
+	return Score{t.White.Middlegame - t.Black.Middlegame, t.White.Endgame - t.Black.Endgame}
+}
+
+// Trace is the evaluation broken down into its terms
+type Trace struct {
+	Terms [NUMBER_OF_TERMS]TermTrace
+	Phase int32
+	Score int32 // The tapered score, from white's point of view
+}
+
+// EvaluateTrace evaluates the position, keeping the contribution of every term
+func EvaluateTrace(position *Position) *Trace {
+	trace := &Trace{}
+	evaluate(position, currentParams(), trace)
+	return trace
+}
+
+// evaluator accumulates the terms of both sides, indexed by color
+type evaluator struct {
+	terms [NUMBER_OF_TERMS][2]Score
+}
+
+func (e *evaluator) add(color Color, term Term, middlegame int32, endgame int32) {
+	e.terms[term][color].Middlegame += middlegame
+	e.terms[term][color].Endgame += endgame
+}
+
+func (e *evaluator) addScore(color Color, term Term, score Score) {
+	e.terms[term][color].Middlegame += score.Middlegame
+	e.terms[term][color].Endgame += score.Endgame
+}
+
+func (e *evaluator) addScaled(color Color, term Term, score Score, times int32) {
+	e.terms[term][color].Middlegame += score.Middlegame * times
+	e.terms[term][color].Endgame += score.Endgame * times
+}
+
+func (e *evaluator) addMaterial(color Color, params *EvalParams, pawns int32, knights int32, bishops int32, rooks int32, queens int32) {
+	e.addScaled(color, Material, params.Pawn, pawns)
+	e.addScaled(color, Material, params.Knight, knights)
+	e.addScaled(color, Material, params.Bishop, bishops)
+	e.addScaled(color, Material, params.Rook, rooks)
+	e.addScaled(color, Material, params.Queen, queens)
+}
+
+// score sums the terms, from white's point of view
+func (e *evaluator) score() Score {
+	score := Score{}
+	for term := range e.terms {
+		score.add(e.terms[term][White].Middlegame-e.terms[term][Black].Middlegame,
+			e.terms[term][White].Endgame-e.terms[term][Black].Endgame)
+	}
+	return score
+}
+
+func (e *evaluator) fillTrace(trace *Trace) {
+	for term := range e.terms {
+		trace.Terms[term] = TermTrace{e.terms[term][White], e.terms[term][Black]}
+	}
+}
+
+// String prints the trace as a table, the scores are in centipawns from white's point of view
+func (t *Trace) String() string {
+	var buffer bytes.Buffer
+	line := "+----------------+-------------+-------------+-------------+\n"
+	buffer.WriteString(line)
+	buffer.WriteString("|           Term |    White    |    Black    |    Total    |\n")
+	buffer.WriteString("|                |   MG    EG  |   MG    EG  |   MG    EG  |\n")
+	buffer.WriteString(line)
+	for term, trace := range t.Terms {
+		total := trace.Total()
+		buffer.WriteString(fmt.Sprintf("| %14s | %5d %5d | %5d %5d | %5d %5d |\n", Term(term),
+			trace.White.Middlegame, trace.White.Endgame, trace.Black.Middlegame, trace.Black.Endgame,
+			total.Middlegame, total.Endgame))
+	}
+	buffer.WriteString(line)
+	buffer.WriteString(fmt.Sprintf("Phase: %d/%d\nScore: %d (white side)\n", t.Phase, MAX_PHASE, t.Score))
+	return buffer.String()
+}
+
+type jsonTerm struct {
+	Name  string `json:"name"`
+	White Score  `json:"white"`
+	Black Score  `json:"black"`
+	Total Score  `json:"total"`
+}
+
+type jsonTrace struct {
+	Terms []jsonTerm `json:"terms"`
+	Phase int32      `json:"phase"`
+	Score int32      `json:"score"`
+}
+
+func (t *Trace) MarshalJSON() ([]byte, error) {
+	terms := make([]jsonTerm, len(t.Terms))
+	for term, trace := range t.Terms {
+		terms[term] = jsonTerm{Term(term).String(), trace.White, trace.Black, trace.Total()}
+	}
+	return json.Marshal(jsonTrace{terms, t.Phase, t.Score})
+}
@@ -0,0 +1,174 @@
+package evaluation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	. "github.com/amanjpro/zahak/engine"
+)
+
+// WDLModel maps a score and the game phase to the win, draw and loss probabilities.
+// The win rate is a logistic function of the score, 1 / (1 + exp((A - score) / B)),
+// where A and B are interpolated between the endgame and the opening by the phase.
+// The interpolation follows 1 - (1 - phase/MAX_PHASE)^3, most of the change is in
+// the endgame, where the scores grow the fastest, and the middlegame stays close to
+// the opening. A is the score that wins half of the games, and it is what the
+// scores are normalized by
+type WDLModel struct {
+	OpeningA float64
+	EndgameA float64
+	OpeningB float64
+	EndgameB float64
+}
+
+// The default model, fitted with `zahak -fit-wdl evaluation/testdata/selfplay-positions.txt.gz`.
+// The file holds every 8th quiet position of 2000 self-play games of this version at depth 6,
+// each starting with 8 random moves (seed 1), 22844 positions in all. The model should be
+// refitted whenever the evaluation changes
+var DefaultWDLModel = WDLModel{103, 662, 146, 310}
+
+// WDL are the win, draw and loss probabilities in per mille
+type WDL struct {
+	Win  int
+	Draw int
+	Loss int
+}
+
+// WDLSample is the score of a position, its phase and the outcome of the game for the
+// side to move: 1 for a win, 0 for a draw and -1 for a loss
+type WDLSample struct {
+	Score   int32
+	Phase   int32
+	Outcome int8
+}
+
+func (m WDLModel) params(phase int32) (float64, float64) {
+	weight := 1 - math.Pow(1-float64(phase)/float64(MAX_PHASE), 3)
+	a := m.EndgameA + (m.OpeningA-m.EndgameA)*weight
+	b := m.EndgameB + (m.OpeningB-m.EndgameB)*weight
+	return a, b
+}
+
+// WinRate is the probability that the side to move wins
+func (m WDLModel) WinRate(score int32, phase int32) float64 {
+	a, b := m.params(phase)
+	return 1 / (1 + math.Exp((a-float64(score))/b))
+}
+
+func (m WDLModel) WDL(score int32, phase int32) WDL {
+	win := int(math.Round(1000 * m.WinRate(score, phase)))
+	loss := int(math.Round(1000 * m.WinRate(-score, phase)))
+	return WDL{win, 1000 - win - loss, loss}
+}
+
+// Normalize scales the score so that 100 wins half of the games, mate scores are kept as they are
+func (m WDLModel) Normalize(score int32, phase int32) int32 {
+	if score >= CHECKMATE_EVAL || score <= -CHECKMATE_EVAL {
+		return score
+	}
+	a, _ := m.params(phase)
+	return int32(math.Round(float64(score) * 100 / a))
+}
+
+// likelihood is the mean log likelihood of the outcomes of the samples
+func (m WDLModel) likelihood(samples []WDLSample) float64 {
+	sum := 0.0
+	for _, sample := range samples {
+		win := m.WinRate(sample.Score, sample.Phase)
+		loss := m.WinRate(-sample.Score, sample.Phase)
+		p := 1 - win - loss
+		if sample.Outcome > 0 {
+			p = win
+		} else if sample.Outcome < 0 {
+			p = loss
+		}
+		sum += math.Log(math.Max(p, 1e-12))
+	}
+	return sum / float64(len(samples))
+}
+
+// FitWDLModel fits the model to the outcomes of games, with a local search that nudges
+// one parameter at a time, and halves the steps when no nudge helps
+func FitWDLModel(samples []WDLSample, initial WDLModel) WDLModel {
+	if len(samples) == 0 {
+		return initial
+	}
+	best := initial
+	bestLikelihood := best.likelihood(samples)
+	step := 32.0
+	for step >= 0.5 {
+		improved := false
+		for i := 0; i < 4; i++ {
+			for _, sign := range []float64{1, -1} {
+				candidate := best
+				param := candidate.param(i)
+				*param += sign * step
+				if *param < 1 {
+					continue
+				}
+				if likelihood := candidate.likelihood(samples); likelihood > bestLikelihood {
+					best = candidate
+					bestLikelihood = likelihood
+					improved = true
+				}
+			}
+		}
+		if !improved {
+			step /= 2
+		}
+	}
+	return best
+}
+
+func (m *WDLModel) param(i int) *float64 {
+	switch i {
+	case 0:
+		return &m.OpeningA
+	case 1:
+		return &m.EndgameA
+	case 2:
+		return &m.OpeningB
+	}
+	return &m.EndgameB
+}
+
+// ReadWDLSamples reads lines of a FEN, the result of the game from white's point of view
+// as [1.0], [0.5] or [0.0], and the score of the position from white's point of view,
+// anything after the score is ignored. The samples are from white's point of view, the
+// model is symmetric, so it fits them as well as samples from the side to move's
+func ReadWDLSamples(reader io.Reader) ([]WDLSample, error) {
+	var samples []WDLSample
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 8 {
+			return samples, fmt.Errorf("line %d: expected a FEN, a result and a score", lineNumber)
+		}
+		outcome := int8(0)
+		switch fields[6] {
+		case "[1.0]":
+			outcome = 1
+		case "[0.0]":
+			outcome = -1
+		case "[0.5]":
+		default:
+			return samples, fmt.Errorf("line %d: %s is not a valid result", lineNumber, fields[6])
+		}
+		score, err := strconv.Atoi(fields[7])
+		if err != nil {
+			return samples, fmt.Errorf("line %d: %s is not a valid score", lineNumber, fields[7])
+		}
+		game := FromFen(strings.Join(fields[:6], " "), false)
+		samples = append(samples, WDLSample{int32(score), game.Position().Phase(), outcome})
+	}
+	return samples, scanner.Err()
+}
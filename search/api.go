@@ -0,0 +1,136 @@
+package search
+
+import (
+	"time"
+
+	. "github.com/amanjpro/zahak/cache"
+	. "github.com/amanjpro/zahak/engine"
+	. "github.com/amanjpro/zahak/evaluation"
+)
+
+const MAX_DEPTH = int8(100)
+
+// Limits are the conditions that end a search, the zero value searches until
+// the search is stopped, or the context is done
+type Limits struct {
+	Depth        int8   // 0 for no depth limit
+	Nodes        int64  // 0 for no node limit
+	MoveTime     int64  // Exact time for the move in milliseconds, 0 if there is none
+	Time         int64  // The clock of the side to move in milliseconds, 0 if there is none
+	Increment    int64  // The increment of the side to move in milliseconds
+	MovesToGo    int    // Moves until the next time control, 0 for sudden death
+	MoveOverhead int64  // The time that is lost on every move, in milliseconds
+	Ply          uint16 // The ply of the game, the transposition table entries are aged by it
+	// Contempt is how much, in centipawns, the side to move at the root dislikes draws,
+	// negative values make it seek draws
+	Contempt      int32
+	ScaleContempt bool // Scale the contempt down, as the pieces come off the board
+}
+
+// SearchResult is the outcome of a search, or of an iteration of it
+type SearchResult struct {
+	BestMove   Move
+	PonderMove Move     // The expected reply, EmptyMove if there is none
+	Score      int32    // In centipawns, from the side to move's point of view
+	Normalized int32    // The score scaled so that 100 wins half of the games
+	WDL        WDL      // The win, draw and loss chances of the side to move, in per mille
+	MateIn     int      // Moves to mate, negative when getting mated, 0 if there is no mate
+	Bound      NodeType // Exact, or LowerBound and UpperBound when an aspiration search fails
+	Depth      int8
+	SelDepth   int8
+	Nodes      int64
+	Time       time.Duration
+	PV         []Move
+}
+
+// InfoListener is notified about the progress of a search, by the main thread only
+type InfoListener interface {
+	// OnIteration is called when an iteration finishes, and when the aspiration
+	// window of an iteration fails high or low
+	OnIteration(info SearchResult)
+	// OnRootMove is called when a root move is about to be searched
+	OnRootMove(depth int8, move Move, moveNumber int)
+}
+
+func (e *Engine) SetInfoListener(listener InfoListener) {
+	e.listener = listener
+}
+
+func (e *Engine) newResult(position *Position, depth int8, pv *PVLine, score int32, bound NodeType, nodes int64) SearchResult {
+	line := make([]Move, pv.moveCount)
+	copy(line, pv.line[:pv.moveCount])
+	phase := position.Phase()
+	result := SearchResult{EmptyMove, EmptyMove, score, DefaultWDLModel.Normalize(score, phase), DefaultWDLModel.WDL(score, phase),
+		0, bound, depth, e.selDepth, nodes, time.Now().Sub(e.startTime), line}
+	if len(line) > 0 {
+		result.BestMove = line[0]
+	}
+	if len(line) > 1 {
+		result.PonderMove = line[1]
+	}
+	// Mate scores do not keep the distance to mate, the pv and the hash moves do
+	if score == CHECKMATE_EVAL {
+		result.MateIn = (mateDistance(position, line) + 1) / 2
+	} else if score == -CHECKMATE_EVAL {
+		result.MateIn = -mateDistance(position, line) / 2
+	}
+	return result
+}
+
+// mateDistance is the number of plies to the checkmate, following the pv then
+// the hash moves, as the pv is often cut by the transposition table
+func mateDistance(position *Position, pv []Move) int {
+	p := position.Copy()
+	plies := 0
+	for ; plies < int(MAX_SEARCH_HEIGHT); plies++ {
+		var move Move
+		if plies < len(pv) {
+			move = pv[plies]
+		} else {
+			cachedEval, found := TranspositionTable.Get(p.Hash())
+			if !found || cachedEval.Move == 0 {
+				break
+			}
+			valid, ok := p.ValidateMove(UnpackMove(cachedEval.Move))
+			if !ok {
+				break
+			}
+			move = valid
+		}
+		p.MakeMove(move)
+	}
+	return plies
+}
+
+// setUnresolved keeps the result of an aspiration search that failed, it is the
+// result of the search if it stops before the iteration is resolved. After a
+// fail-high the new best move is reported, after a fail-low the previous one is
+func (e *Engine) setUnresolved(position *Position, depth int8, pv *PVLine, score int32, bound NodeType) {
+	if e.isHelper {
+		return
+	}
+	result := e.newResult(position, depth, pv, score, bound, 0)
+	e.unresolved = &result
+}
+
+// The nodes of all threads, while they are searching it is an estimate
+func (e *Engine) totalNodes() int64 {
+	if len(e.helpers) == 0 {
+		return e.nodesVisited
+	}
+	return e.control.Nodes()
+}
+
+func (e *Engine) notifyIteration(position *Position, depth int8, pv *PVLine, score int32, bound NodeType) {
+	if e.isHelper || e.listener == nil {
+		return
+	}
+	e.listener.OnIteration(e.newResult(position, depth, pv, score, bound, e.totalNodes()))
+}
+
+func (e *Engine) notifyRootMove(depth int8, move Move, moveNumber int) {
+	if e.isHelper || e.listener == nil {
+		return
+	}
+	e.listener.OnRootMove(depth, move, moveNumber)
+}
@@ -0,0 +1,22 @@
+package search
+
+import (
+	. "github.com/amanjpro/zahak/engine"
+)
+
+// drawScore is the score of a draw for the side to move, the root side avoids draws
+// by the contempt, and its opponent seeks them by as much
+func (e *Engine) drawScore(position *Position) int32 {
+	contempt := e.contempt
+	if contempt == 0 {
+		return 0
+	}
+	if e.scaleContempt {
+		// The full contempt with all the pieces, half of it in pawn endgames
+		contempt = contempt * (MAX_PHASE + position.Phase()) / (2 * MAX_PHASE)
+	}
+	if position.Turn() == e.rootColor {
+		return -contempt
+	}
+	return contempt
+}
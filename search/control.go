@@ -0,0 +1,119 @@
+package search
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The nodes a thread visits before reporting them to the search control
+const NODES_PER_REPORT = int64(1024)
+
+// Think times from this on are considered infinite
+const MAX_THINK_TIME = int64(1_000_000_000_000)
+
+// SearchControl decides when a search, and all of its threads, should stop: when asked
+// to, when the time is up, when the context is done or when the node limit is reached.
+// The nodes only check a flag, the clock and the context are watched by a goroutine
+type SearchControl struct {
+	stopped    int32 // Accessed atomically
+	nodes      int64 // Accessed atomically, the nodes of all the threads
+	nodeLimit  int64 // 0 when there is no limit
+	lock       sync.Mutex
+	generation int64 // Every search has its own generation, so late timers are ignored
+	done       chan struct{}
+	armed      bool // Arm was called for the next search, guarded by the lock
+}
+
+func NewSearchControl() *SearchControl {
+	return &SearchControl{}
+}
+
+// Arm prepares the control for the next search, a Stop from now on stops that search,
+// even when it comes before the search starts
+func (c *SearchControl) Arm() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.armed = true
+	atomic.StoreInt32(&c.stopped, 0)
+}
+
+// Start prepares the control for a new search, that should stop after thinkTime
+// milliseconds, after visiting nodeLimit nodes, or when the context is done. A control
+// that is not armed is armed first, otherwise the stops since Arm are kept
+func (c *SearchControl) Start(ctx context.Context, thinkTime int64, nodeLimit int64) {
+	c.Finish()
+
+	c.lock.Lock()
+	c.generation += 1
+	generation := c.generation
+	if !c.armed {
+		atomic.StoreInt32(&c.stopped, 0)
+	}
+	c.armed = false
+	atomic.StoreInt64(&c.nodes, 0)
+	c.nodeLimit = nodeLimit
+	done := make(chan struct{})
+	c.done = done
+	c.lock.Unlock()
+
+	var timer *time.Timer
+	var timeout <-chan time.Time // Never fires, when there is no time limit
+	if thinkTime < MAX_THINK_TIME {
+		timer = time.NewTimer(time.Duration(thinkTime) * time.Millisecond)
+		timeout = timer.C
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.stopGeneration(generation)
+		case <-timeout:
+			c.stopGeneration(generation)
+		case <-done:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+}
+
+// Finish releases the watcher of the current search
+func (c *SearchControl) Finish() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.done != nil {
+		close(c.done)
+		c.done = nil
+	}
+}
+
+func (c *SearchControl) stopGeneration(generation int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.generation == generation {
+		atomic.StoreInt32(&c.stopped, 1)
+	}
+}
+
+// Stop stops the current search, it is safe to call from any goroutine
+func (c *SearchControl) Stop() {
+	atomic.StoreInt32(&c.stopped, 1)
+}
+
+func (c *SearchControl) IsStopped() bool {
+	return atomic.LoadInt32(&c.stopped) != 0
+}
+
+// addNodes is called by every thread every few nodes, to enforce the node limit
+// on the total number of nodes
+func (c *SearchControl) addNodes(nodes int64) {
+	if total := atomic.AddInt64(&c.nodes, nodes); c.nodeLimit > 0 && total >= c.nodeLimit {
+		c.Stop()
+	}
+}
+
+// Nodes is the number of nodes reported by all the threads so far
+func (c *SearchControl) Nodes() int64 {
+	return atomic.LoadInt64(&c.nodes)
+}
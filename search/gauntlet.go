@@ -0,0 +1,188 @@
+package search
+
+import (
+	"context"
+	"math"
+	"math/rand"
+
+	. "github.com/amanjpro/zahak/cache"
+	. "github.com/amanjpro/zahak/engine"
+)
+
+const gauntletStartFen = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// A game is adjudicated as a win when the side to move reports at least this
+// score for GAUNTLET_WIN_PLIES plies in a row
+const GAUNTLET_WIN_SCORE = int32(1000)
+const GAUNTLET_WIN_PLIES = 6
+
+type GauntletOptions struct {
+	Games       int // The number of games between every level and the level below it, half of them with each color
+	RandomPlies int // The number of random moves the games start with
+	MaxPlies    int // Games that last longer are drawn
+	Seed        int64
+	// OnPair is called after the games of every level against the level below it
+	OnPair func(pair GauntletPair)
+}
+
+// GauntletPair is the result of a level against the level below it
+type GauntletPair struct {
+	Level   int
+	Games   int
+	Points  float64 // The points of Level, 1 for every win and 0.5 for every draw
+	Squares float64 // The sum of the squares of the points of every game, for the variance
+}
+
+func (p GauntletPair) Score() float64 {
+	return p.Points / float64(p.Games)
+}
+
+// Elo is the Elo difference that the score amounts to, a perfect score is
+// counted as half a game less than it, to keep the difference finite
+func (p GauntletPair) Elo() float64 {
+	margin := 0.5 / float64(p.Games)
+	score := math.Max(margin, math.Min(1-margin, p.Score()))
+	return -400 * math.Log10(1/score-1)
+}
+
+// EloError is the standard error of Elo, from the variance of the game results
+func (p GauntletPair) EloError() float64 {
+	margin := 0.5 / float64(p.Games)
+	score := math.Max(margin, math.Min(1-margin, p.Score()))
+	variance := math.Max(p.Squares/float64(p.Games)-p.Score()*p.Score(), margin*(1-margin))
+	scoreError := math.Sqrt(variance / float64(p.Games))
+	return 400 / math.Ln10 * scoreError / (score * (1 - score))
+}
+
+// SkillGauntlet plays every limited skill level against the level below it. The
+// transposition table is cleared before every move, so that a level does not use
+// the searches of the other
+func SkillGauntlet(ctx context.Context, options GauntletOptions) []GauntletPair {
+	if options.Games < 2 {
+		options.Games = 2
+	}
+	if options.MaxPlies <= 0 {
+		options.MaxPlies = 300
+	}
+	FromFen(gauntletStartFen, true) // Initializes the hash keys, the games keep them
+	random := rand.New(rand.NewSource(options.Seed))
+	var pairs []GauntletPair
+	for level := 1; level < MAX_SKILL_LEVEL && ctx.Err() == nil; level++ {
+		strong := NewEngine()
+		strong.Skill = NewSkill(level)
+		strong.random = rand.New(rand.NewSource(options.Seed + int64(2*level)))
+		weak := NewEngine()
+		weak.Skill = NewSkill(level - 1)
+		weak.random = rand.New(rand.NewSource(options.Seed + int64(2*level+1)))
+		pair := GauntletPair{level, 0, 0, 0}
+		for i := 0; i < options.Games && ctx.Err() == nil; i++ {
+			// The same opening is played with both colors
+			random.Seed(options.Seed + int64(level*options.Games+i/2))
+			var points float64
+			if i%2 == 0 {
+				points = playGauntletGame(ctx, strong, weak, random, options)
+			} else {
+				points = 1 - playGauntletGame(ctx, weak, strong, random, options)
+			}
+			pair.Games++
+			pair.Points += points
+			pair.Squares += points * points
+		}
+		pairs = append(pairs, pair)
+		if options.OnPair != nil {
+			options.OnPair(pair)
+		}
+	}
+	return pairs
+}
+
+// FitSkillElos fits the Elo gained by every level over the level below it as
+// a*r^level, weighting every pair by its error, and returns the Elo of every
+// limited level relative to level 0. The gains of the fit are all positive as long
+// as the levels are stronger than the levels below them on the whole
+func FitSkillElos(pairs []GauntletPair) []float64 {
+	bestA, bestR, bestError := 0.0, 1.0, math.Inf(1)
+	for r := 0.8; r <= 1.25; r += 0.001 {
+		// For a given r, the best a is a weighted least squares fit
+		var sxy, sxx float64
+		for _, pair := range pairs {
+			w := 1 / math.Pow(pair.EloError(), 2)
+			x := math.Pow(r, float64(pair.Level))
+			sxy += w * x * pair.Elo()
+			sxx += w * x * x
+		}
+		a := sxy / sxx
+		var squares float64
+		for _, pair := range pairs {
+			w := 1 / math.Pow(pair.EloError(), 2)
+			squares += w * math.Pow(pair.Elo()-a*math.Pow(r, float64(pair.Level)), 2)
+		}
+		if squares < bestError {
+			bestA, bestR, bestError = a, r, squares
+		}
+	}
+
+	elos := make([]float64, MAX_SKILL_LEVEL)
+	for level := 1; level < MAX_SKILL_LEVEL; level++ {
+		elos[level] = elos[level-1] + bestA*math.Pow(bestR, float64(level))
+	}
+	return elos
+}
+
+// playGauntletGame plays a game from a random opening, and returns the result for white
+func playGauntletGame(ctx context.Context, white *Engine, black *Engine, random *rand.Rand, options GauntletOptions) float64 {
+	var game Game
+	ply := 0
+	for {
+		game = FromFen(gauntletStartFen, false)
+		ply = 0
+		for ; ply < options.RandomPlies; ply++ {
+			moves := game.Position().LegalMoves()
+			if len(moves) == 0 {
+				break
+			}
+			game.Move(moves[random.Intn(len(moves))])
+		}
+		if game.Status() == Unknown {
+			break
+		}
+	}
+	position := game.Position()
+
+	winningPlies := 0
+	for ; ply < options.MaxPlies && ctx.Err() == nil; ply++ {
+		turn := position.Turn()
+		switch game.Status() {
+		case Checkmate:
+			if turn == White {
+				return 0
+			}
+			return 1
+		case Draw:
+			return 0.5
+		}
+
+		e := white
+		if turn == Black {
+			e = black
+		}
+		ResetCache()
+		result := e.Search(ctx, position, Limits{Ply: uint16(ply)})
+		if result.BestMove == EmptyMove {
+			break
+		}
+		if abs32(result.Score) >= GAUNTLET_WIN_SCORE {
+			winningPlies++
+			if winningPlies >= GAUNTLET_WIN_PLIES {
+				if (result.Score > 0) == (turn == White) {
+					return 1
+				}
+				return 0
+			}
+		} else {
+			winningPlies = 0
+		}
+		game.Move(result.BestMove)
+	}
+	return 0.5
+}
@@ -0,0 +1,119 @@
+package search
+
+import (
+	. "github.com/amanjpro/zahak/engine"
+)
+
+const MAX_HISTORY = int32(16384)
+const MAX_HISTORY_BONUS = int32(1200)
+const MAX_SEARCH_HEIGHT = 125
+
+// The moves that led to the current node, the continuation histories are
+// indexed by the moves played one and two plies ago
+type stackEntry struct {
+	move  Move
+	piece Piece
+	eval  int32 // The static evaluation of the node, -MAX_INT when in check
+}
+
+type History struct {
+	butterfly    [2][64][64]int32         // color, source and destination
+	counterMoves [12][64]Move             // indexed by the piece and destination of the previous move
+	continuation [2][12][64][12][64]int32 // one and two plies ago
+}
+
+func (h *History) Clear() {
+	*h = History{}
+}
+
+// Age keeps the history of the previous searches, but with less weight
+func (h *History) Age() {
+	for c := 0; c < 2; c++ {
+		for i := 0; i < 64; i++ {
+			for j := 0; j < 64; j++ {
+				h.butterfly[c][i][j] /= 2
+			}
+		}
+	}
+	for c := 0; c < 2; c++ {
+		for p := 0; p < 12; p++ {
+			for i := 0; i < 64; i++ {
+				table := &h.continuation[c][p][i]
+				for q := 0; q < 12; q++ {
+					for j := 0; j < 64; j++ {
+						table[q][j] /= 2
+					}
+				}
+			}
+		}
+	}
+}
+
+// Gravity update, the closer the entry is to MAX_HISTORY the smaller the effect
+// of the bonus, so entries stay bounded without being clamped
+func gravity(entry *int32, bonus int32) {
+	*entry += bonus - *entry*abs32(bonus)/MAX_HISTORY
+}
+
+func historyBonus(depthLeft int8) int32 {
+	return min32(int32(depthLeft)*int32(depthLeft)*16, MAX_HISTORY_BONUS)
+}
+
+func (e *Engine) previousMove(searchHeight int8, plies int8) (stackEntry, bool) {
+	height := searchHeight - plies
+	if height < 0 || int(height) >= len(e.searchStack) {
+		return stackEntry{}, false
+	}
+	entry := e.searchStack[height]
+	return entry, entry.move != EmptyMove && entry.piece != NoPiece
+}
+
+func (e *Engine) pushMove(searchHeight int8, move Move, piece Piece) {
+	if int(searchHeight) < len(e.searchStack) {
+		e.searchStack[searchHeight].move = move
+		e.searchStack[searchHeight].piece = piece
+	}
+}
+
+func (e *Engine) QuietHistory(move Move, piece Piece, searchHeight int8) int32 {
+	score := e.history.butterfly[piece.Color()][move.Source][move.Destination]
+	for plies := int8(1); plies <= 2; plies++ {
+		if prev, ok := e.previousMove(searchHeight, plies); ok {
+			score += e.history.continuation[plies-1][prev.piece][prev.move.Destination][piece][move.Destination]
+		}
+	}
+	return score
+}
+
+func (e *Engine) CounterMove(searchHeight int8) Move {
+	if prev, ok := e.previousMove(searchHeight, 1); ok {
+		return e.history.counterMoves[prev.piece][prev.move.Destination]
+	}
+	return EmptyMove
+}
+
+func (e *Engine) updateQuietHistory(move Move, piece Piece, searchHeight int8, bonus int32) {
+	gravity(&e.history.butterfly[piece.Color()][move.Source][move.Destination], bonus)
+	for plies := int8(1); plies <= 2; plies++ {
+		if prev, ok := e.previousMove(searchHeight, plies); ok {
+			gravity(&e.history.continuation[plies-1][prev.piece][prev.move.Destination][piece][move.Destination], bonus)
+		}
+	}
+}
+
+// AddHistory rewards a quiet move that caused a beta cutoff, and penalizes the
+// quiet moves that were searched before it and failed to cut
+func (e *Engine) AddHistory(position *Position, move Move, searchHeight int8, depthLeft int8, failedQuiets []Move) {
+	if move.HasTag(Capture) {
+		return
+	}
+	board := position.Board
+	bonus := historyBonus(depthLeft)
+	e.updateQuietHistory(move, board.PieceAt(move.Source), searchHeight, bonus)
+	for _, quiet := range failedQuiets {
+		e.updateQuietHistory(quiet, board.PieceAt(quiet.Source), searchHeight, -bonus)
+	}
+	if prev, ok := e.previousMove(searchHeight, 1); ok {
+		e.history.counterMoves[prev.piece][prev.move.Destination] = move
+	}
+}
@@ -1,150 +1,264 @@
 package search
 
 import (
-	. "github.com/amanjpro/zahak/cache"
 	. "github.com/amanjpro/zahak/engine"
 )
 
+const (
+	hashMoveStage = iota
+	generateCapturesStage
+	goodCapturesStage
+	generateQuietChecksStage
+	quietChecksStage
+	killersStage
+	counterMoveStage
+	generateQuietsStage
+	quietsStage
+	badCapturesStage
+	doneStage
+)
+
+// MovePicker generates moves lazily in stages, most nodes cut off after the first
+// few moves, so we try the hash move before generating anything, and only generate
+// quiet moves once the good captures, the killers and the counter-move are exhausted
 type MovePicker struct {
-	position  *Position
-	engine    *Engine
-	moves     []Move
-	scores    []int32
-	moveOrder int8
-	next      int
+	position         *Position
+	engine           *Engine
+	hashMove         Move
+	searchHeight     int8
+	capturesOnly     bool
+	withChecks       bool
+	stage            int
+	next             int
+	captures         []Move
+	captureScores    []int32
+	badCaptures      []Move
+	badCaptureScores []int32
+	quietChecks      []Move
+	killers          [2]Move
+	counterMove      Move
+	quiets           []Move
+	quietScores      []int32
+	played           []Move
+	replay           int
 }
 
-func NewMovePicker(p *Position, e *Engine, moves []Move, moveOrder int8) *MovePicker {
-	mp := &MovePicker{
+// NewMovePicker creates a picker for the position, if capturesOnly is set only the hash
+// move and the captures with non-negative static exchange are returned
+func NewMovePicker(p *Position, e *Engine, hashMove Move, searchHeight int8, capturesOnly bool) *MovePicker {
+	return &MovePicker{
 		p,
 		e,
-		moves,
-		make([]int32, len(moves)),
-		moveOrder,
+		hashMove,
+		searchHeight,
+		capturesOnly,
+		false,
+		hashMoveStage,
+		0,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		[2]Move{EmptyMove, EmptyMove},
+		EmptyMove,
+		nil,
+		nil,
+		make([]Move, 0, 16),
 		0,
 	}
-
-	mp.score()
-	return mp
 }
 
-func (mp *MovePicker) score() {
-	pv := mp.engine.pv
-	position := mp.position
-	board := position.Board
-	engine := mp.engine
-	moveOrder := mp.moveOrder
-
-	for i, move := range mp.moves {
-		// Is in PV?
-		if pv != nil && pv.moveCount > moveOrder {
-			mv := pv.MoveAt(moveOrder)
-			if mv == move {
-				mp.scores[i] = 900_000_000
-				continue
-			}
-		}
+// skipHashMove is used to exclude the hash move from the singular extension search
+func (mp *MovePicker) skipHashMove() {
+	if mp.stage == hashMoveStage {
+		mp.stage = generateCapturesStage
+	}
+}
 
-		// Is in Transition table ???
-		// TODO: This is slow, that tells us either cache access is slow or has computation is
-		// Or maybe (unlikely) make/unmake move is slow
-		cp, ep, tg, hc := position.MakeMove(move)
-		hash := position.Hash()
-		position.UnMakeMove(move, tg, ep, cp, hc)
-		eval, ok := TranspositionTable.Get(hash)
+// withQuietChecks makes a captures only picker return the quiet moves that give check
+// after the good captures, it is used at the first ply of the quiescence search
+func (mp *MovePicker) withQuietChecks() {
+	mp.withChecks = true
+}
 
-		if ok && eval.Type == Exact {
-			mp.scores[i] = 500_000_000 + eval.Eval
-			continue
-		}
+// Reset replays the moves that are already returned, before continuing with the
+// remaining stages
+func (mp *MovePicker) Reset() {
+	mp.replay = 0
+}
 
-		if ok {
-			mp.scores[i] = 400_000_000 + int32(eval.Depth)
-			continue
-		}
+func (mp *MovePicker) Next() Move {
+	if mp.replay < len(mp.played) {
+		mp.replay += 1
+		return mp.played[mp.replay-1]
+	}
+	move := mp.nextMove()
+	if move != EmptyMove {
+		mp.played = append(mp.played, move)
+		mp.replay += 1
+	}
+	return move
+}
 
-		piece := board.PieceAt(move.Source)
-		//
-		// capture ordering
-		if move.HasTag(Capture) {
-			capPiece := board.PieceAt(move.Destination)
-			if !move.HasTag(EnPassant) {
-				// SEE for ordering
-				gain := board.StaticExchangeEval(move.Destination, capPiece, move.Source, piece)
-				if gain < 0 {
-					mp.scores[i] = -100_000_000 + gain
-				} else if gain == 0 {
-					mp.scores[i] = 100_000_000 + capPiece.Weight() - piece.Weight()
-				} else {
-					mp.scores[i] = 100_010_000 + gain
+func (mp *MovePicker) nextMove() Move {
+	for {
+		switch mp.stage {
+		case hashMoveStage:
+			mp.stage = generateCapturesStage
+			if mp.hashMove != EmptyMove {
+				move, ok := mp.position.ValidateMove(mp.hashMove)
+				if ok && (!mp.capturesOnly || move.HasTag(Capture)) {
+					mp.hashMove = move
+					return move
 				}
+				mp.hashMove = EmptyMove
+			}
+		case generateCapturesStage:
+			mp.scoreCaptures(mp.position.CaptureMoves())
+			mp.next = 0
+			mp.stage = goodCapturesStage
+		case goodCapturesStage:
+			move := mp.pick(mp.captures, mp.captureScores)
+			if move != EmptyMove {
+				return move
+			}
+			mp.next = 0
+			if mp.capturesOnly && mp.withChecks {
+				mp.stage = generateQuietChecksStage
+			} else if mp.capturesOnly {
+				mp.stage = doneStage
 			} else {
-				mp.scores[i] = 100_000_000 + capPiece.Weight() - piece.Weight()
+				mp.stage = killersStage
 			}
-			continue
-		}
-
-		killer := engine.KillerMoveScore(move, moveOrder)
-		if killer != 0 {
-			mp.scores[i] = killer
-			continue
+		case generateQuietChecksStage:
+			mp.quietChecks = mp.position.QuietChecks()
+			mp.next = 0
+			mp.stage = quietChecksStage
+		case quietChecksStage:
+			if mp.next < len(mp.quietChecks) {
+				mp.next += 1
+				return mp.quietChecks[mp.next-1]
+			}
+			mp.stage = doneStage
+		case killersStage:
+			if mp.next >= len(mp.killers) {
+				mp.stage = counterMoveStage
+				continue
+			}
+			i := mp.next
+			mp.next += 1
+			if mp.searchHeight >= int8(len(mp.engine.killerMoves)) || mp.engine.killerMoves[mp.searchHeight] == nil {
+				continue
+			}
+			killer := mp.engine.killerMoves[mp.searchHeight][i]
+			if killer == EmptyMove || killer.HasTag(Capture) {
+				continue
+			}
+			move, ok := mp.position.ValidateMove(killer)
+			if ok && move != mp.hashMove && move != mp.killers[0] {
+				mp.killers[i] = move
+				return move
+			}
+		case counterMoveStage:
+			mp.stage = generateQuietsStage
+			counterMove := mp.engine.CounterMove(mp.searchHeight)
+			if counterMove == EmptyMove || counterMove.HasTag(Capture) {
+				continue
+			}
+			move, ok := mp.position.ValidateMove(counterMove)
+			if ok && move != mp.hashMove && move != mp.killers[0] && move != mp.killers[1] {
+				mp.counterMove = move
+				return move
+			}
+		case generateQuietsStage:
+			mp.scoreQuiets(mp.position.QuietMoves())
+			mp.next = 0
+			mp.stage = quietsStage
+		case quietsStage:
+			move := mp.pick(mp.quiets, mp.quietScores)
+			if move != EmptyMove {
+				return move
+			}
+			mp.next = 0
+			mp.stage = badCapturesStage
+		case badCapturesStage:
+			move := mp.pick(mp.badCaptures, mp.badCaptureScores)
+			if move != EmptyMove {
+				return move
+			}
+			mp.stage = doneStage
+		default:
+			return EmptyMove
 		}
+	}
+}
 
-		history := engine.MoveHistoryScore(piece, move.Destination, moveOrder)
-		if history != 0 {
-			mp.scores[i] = history
-			continue
+// pick returns the best remaining move, skipping the moves that are returned in
+// earlier stages
+func (mp *MovePicker) pick(moves []Move, scores []int32) Move {
+	for mp.next < len(moves) {
+		bestIndex := mp.next
+		for i := mp.next + 1; i < len(moves); i++ {
+			if scores[i] > scores[bestIndex] {
+				bestIndex = i
+			}
 		}
-
-		if move.PromoType != NoType {
-			p := GetPiece(move.PromoType, White)
-			mp.scores[i] = 50_000 + p.Weight()
-			continue
+		moves[mp.next], moves[bestIndex] = moves[bestIndex], moves[mp.next]
+		scores[mp.next], scores[bestIndex] = scores[bestIndex], scores[mp.next]
+		best := moves[mp.next]
+		mp.next += 1
+		if best != mp.hashMove && best != mp.killers[0] && best != mp.killers[1] && best != mp.counterMove {
+			return best
 		}
+	}
+	return EmptyMove
+}
 
-		// prefer checks
-		if move.HasTag(Check) {
-			mp.scores[i] = 10_000
-			continue
+// Captures are ordered by MVV-LVA, and the ones that lose material according to
+// static exchange are postponed after the quiet moves
+func (mp *MovePicker) scoreCaptures(moves []Move) {
+	board := mp.position.Board
+	mp.captures = moves[:0]
+	mp.captureScores = make([]int32, 0, len(moves))
+	for _, move := range moves {
+		piece := board.PieceAt(move.Source)
+		capPiece := board.PieceAt(move.Destination)
+		if move.HasTag(EnPassant) {
+			capPiece = WhitePawn
 		}
-
-		// King safety (castling)
-		castling := KingSideCastle | QueenSideCastle
-		moveIsCastling := move.HasTag(castling)
-		if moveIsCastling {
-			mp.scores[i] = 3_000
-			continue
+		if !move.HasTag(EnPassant) && capPiece.Weight() < piece.Weight() {
+			gain := board.StaticExchangeEval(move.Destination, capPiece, move.Source, piece)
+			if gain < 0 {
+				mp.badCaptures = append(mp.badCaptures, move)
+				mp.badCaptureScores = append(mp.badCaptureScores, gain)
+				continue
+			}
 		}
-
-		// Prefer smaller pieces
-		if piece.Type() == King {
-			mp.scores[i] = 0
-			continue
+		score := 10*capPiece.Weight() - int32(piece.Type())
+		if move.PromoType != NoType {
+			promoPiece := GetPiece(move.PromoType, White)
+			score += promoPiece.Weight()
 		}
-
-		mp.scores[i] = 1000 - piece.Weight()
+		mp.captures = append(mp.captures, move)
+		mp.captureScores = append(mp.captureScores, score)
 	}
 }
 
-func (mp *MovePicker) Reset() {
-	mp.next = 0
-}
-
-func (mp *MovePicker) Next() Move {
-	if mp.next >= len(mp.moves) {
-		return EmptyMove
-	}
-	var best Move = mp.moves[mp.next]
-	var bestIndex = mp.next
-	for i := mp.next + 1; i < len(mp.moves); i++ {
-		move := mp.moves[i]
-		if mp.scores[i] > mp.scores[bestIndex] {
-			best = move
-			bestIndex = i
+// Quiet moves are ordered by butterfly and continuation history, but queen promotions come first and
+// under-promotions last
+func (mp *MovePicker) scoreQuiets(moves []Move) {
+	board := mp.position.Board
+	mp.quiets = moves
+	mp.quietScores = make([]int32, len(moves))
+	for i, move := range moves {
+		if move.PromoType == Queen {
+			mp.quietScores[i] = MAX_INT
+		} else if move.PromoType != NoType {
+			mp.quietScores[i] = -MAX_INT
+		} else {
+			piece := board.PieceAt(move.Source)
+			mp.quietScores[i] = mp.engine.QuietHistory(move, piece, mp.searchHeight)
 		}
 	}
-	mp.moves[mp.next], mp.moves[bestIndex] = mp.moves[bestIndex], mp.moves[mp.next]
-	mp.scores[mp.next], mp.scores[bestIndex] = mp.scores[bestIndex], mp.scores[mp.next]
-	mp.next += 1
-	return best
 }
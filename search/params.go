@@ -0,0 +1,18 @@
+package search
+
+// SearchParams are the tunable parameters of the search heuristics
+type SearchParams struct {
+	IIRMinDepth      int8  // Internal iterative reductions are applied from this depth on
+	ProbCutMinDepth  int8  // ProbCut is tried from this depth on
+	ProbCutMargin    int32 // How much a capture should beat beta by, to cut the node
+	ProbCutReduction int8  // The depth reduction of the ProbCut verification search
+}
+
+func NewSearchParams() SearchParams {
+	return SearchParams{
+		4,
+		5,
+		100,
+		4,
+	}
+}
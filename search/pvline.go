@@ -27,7 +27,7 @@ func (thisLine *PVLine) ReplaceLine(otherLine *PVLine) {
 	} else {
 		thisLine.moveCount = 0
 	}
-	for i := 0; i < otherLineLen; i++ {
+	for i := 0; i < otherLineLen && i+1 < len(thisLine.line); i++ { // extensions can make the other line longer
 		thisLine.moveCount += 1
 		thisLine.line[i+1] = otherLine.line[i]
 	}
@@ -52,7 +52,7 @@ func (thisLine *PVLine) Recycle() {
 
 func (pv *PVLine) Pop() Move {
 	var toReturn Move
-	if pv.moveCount >= 0 {
+	if pv.moveCount > 0 {
 		emptySlice := make([]Move, len(pv.line))
 		mv, newSlice := pv.line[0], pv.line[1:]
 		toReturn = mv
@@ -1,70 +1,123 @@
 package search
 
 import (
+	. "github.com/amanjpro/zahak/cache"
 	. "github.com/amanjpro/zahak/engine"
 	. "github.com/amanjpro/zahak/evaluation"
 )
 
-func (e *Engine) quiescence(position *Position, alpha int32, beta int32, ply int8, standPat int32, searchHeight int8) int32 {
+const DELTA_MARGIN = int32(200)
 
-	e.VisitNode()
+func (e *Engine) quiescence(position *Position, alpha int32, beta int32, qDepth int8, standPat int32, searchHeight int8, ply uint16) int32 {
 
-	if standPat >= beta {
-		return beta // fail hard
-	}
+	e.VisitNode()
+	e.updateSelDepth(searchHeight)
 
 	isInCheck := position.IsInCheck()
-	// Delta pruning is slowing things down
-	// p := WhitePawn
-	// deltaMargin := int32(p.Weight() * 1)
-	// if !isInCheck && standPat < alpha-deltaMargin { // is capture
-	// 	return alpha
-	// }
 
-	if alpha < standPat {
-		alpha = standPat
+	// When in check, every evasion is searched, standing pat is not an option
+	if !isInCheck {
+		if standPat >= beta {
+			return beta // fail hard
+		}
+		if alpha < standPat {
+			alpha = standPat
+		}
 	}
 
-	withChecks := false && ply <= 4
-	legalMoves := position.QuiesceneMoves(withChecks)
+	if position.IsFIDEDrawRule() {
+		return e.drawScore(position)
+	}
 
-	if len(legalMoves) == 0 {
-		outcome := position.Status()
-		if outcome == Checkmate {
-			return -CHECKMATE_EVAL
-		} else if outcome == Draw {
-			return 0
+	if searchHeight >= MAX_SEARCH_HEIGHT-1 {
+		return standPat
+	}
+
+	// The quiescence entries are stored with depth 0, so any entry can be used here
+	hash := position.Hash()
+	cachedEval, found := TranspositionTable.Get(hash)
+	hashMove := EmptyMove
+	if found {
+		if cachedEval.Move != 0 {
+			hashMove = UnpackMove(cachedEval.Move)
+		}
+		score := cachedEval.Eval
+		if score >= beta && (cachedEval.Type == LowerBound || cachedEval.Type == Exact) {
+			e.CacheHit()
+			return beta
+		}
+		if score <= alpha && (cachedEval.Type == UpperBound || cachedEval.Type == Exact) {
+			e.CacheHit()
+			return alpha
 		}
-	} else if position.IsFIDEDrawRule() { // an optimization to not call isInCheck much
-		return 0
 	}
 
-	movePicker := NewMovePicker(position, e, legalMoves, searchHeight)
+	// When not in check, only captures that do not lose material are searched (SEE pruning),
+	// and at the first ply the quiet checks too, to reduce the horizon effect
+	movePicker := NewMovePicker(position, e, hashMove, searchHeight, !isInCheck)
+	if !isInCheck && qDepth == 0 {
+		movePicker.withQuietChecks()
+	}
 
 	if e.ShouldStop() {
 		return standPat
 	}
 
-	for i := 0; i < len(legalMoves); i++ {
-		move := movePicker.Next()
-		if !isInCheck && move.HasTag(Capture) && !move.HasTag(EnPassant) {
-			// SEE pruning
-			if movePicker.scores[i] < 0 {
+	move := movePicker.Next()
+	if move == EmptyMove {
+		outcome := position.Status()
+		if outcome == Checkmate {
+			return -CHECKMATE_EVAL
+		} else if outcome == Draw {
+			return e.drawScore(position)
+		}
+	}
+
+	originalAlpha := alpha
+	bestMove := EmptyMove
+	for ; move != EmptyMove; move = movePicker.Next() {
+		// Delta Pruning: skip the moves that cannot raise the score to alpha, even
+		// with a margin, and the quiet checks that lose the checking piece
+		if !isInCheck {
+			threshold := alpha - standPat - DELTA_MARGIN
+			if !move.HasTag(Capture) && threshold < 0 {
+				threshold = 0
+			}
+			if !position.SeeAtLeast(move, threshold) {
 				continue
 			}
 		}
+		e.pushMove(searchHeight, move, position.Board.PieceAt(move.Source))
 		cp, ep, tg, hc := position.MakeMove(move)
 		sp := Evaluate(position)
-		score := -e.quiescence(position, -beta, -alpha, ply+1, sp, searchHeight+1)
+		score := -e.quiescence(position, -beta, -alpha, qDepth+1, sp, searchHeight+1, ply)
 		position.UnMakeMove(move, tg, ep, cp, hc)
 		if score >= beta {
 			e.AddKillerMove(move, searchHeight)
+			e.storeQuiescence(hash, cachedEval, found, ply, beta, LowerBound, move)
 			return beta
 		}
 		if score > alpha {
-			e.AddMoveHistory(move, position.Board.PieceAt(move.Source), move.Destination, searchHeight)
 			alpha = score
+			bestMove = move
 		}
 	}
+	if bestMove != EmptyMove && alpha > originalAlpha {
+		e.storeQuiescence(hash, cachedEval, found, ply, alpha, Exact, bestMove)
+	} else {
+		e.storeQuiescence(hash, cachedEval, found, ply, alpha, UpperBound, EmptyMove)
+	}
 	return alpha
 }
+
+// storeQuiescence never replaces the entries of the main search for the same position
+func (e *Engine) storeQuiescence(hash uint64, cachedEval CachedEval, found bool, ply uint16, score int32, nodeType NodeType, move Move) {
+	if e.ShouldStop() || (found && cachedEval.Depth > 0) {
+		return
+	}
+	packed := uint32(0)
+	if move != EmptyMove {
+		packed = move.Pack()
+	}
+	TranspositionTable.Set(hash, CachedEval{hash, score, 0, nodeType, ply, packed})
+}
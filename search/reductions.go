@@ -0,0 +1,58 @@
+package search
+
+import (
+	"math"
+
+	. "github.com/amanjpro/zahak/engine"
+)
+
+const MAX_LMP_DEPTH = int8(7)
+
+var lmrTable = initializeLMRTable()
+
+// Late move reductions grow with both the remaining depth and the number of moves
+// that are already searched
+func initializeLMRTable() [64][64]int8 {
+	var table [64][64]int8
+	for depth := 1; depth < 64; depth++ {
+		for moveNumber := 1; moveNumber < 64; moveNumber++ {
+			table[depth][moveNumber] = int8(0.75 + math.Log(float64(depth))*math.Log(float64(moveNumber))/2.25)
+		}
+	}
+	return table
+}
+
+func lmrReduction(depthLeft int8, moveNumber int) int8 {
+	if depthLeft > 63 {
+		depthLeft = 63
+	}
+	if moveNumber > 63 {
+		moveNumber = 63
+	}
+	return lmrTable[depthLeft][moveNumber]
+}
+
+// The number of quiet moves that are searched before pruning the rest, at shallow depths
+func lateMovePruningCount(depthLeft int8, improving bool) int {
+	count := 3 + int(depthLeft)*int(depthLeft)
+	if !improving {
+		return count / 2
+	}
+	return count
+}
+
+// The position is improving if the static evaluation is better than it was the
+// last time we were to move, when unknown we assume it is improving, to prune less
+func (e *Engine) isImproving(searchHeight int8, eval int32) bool {
+	if searchHeight < 2 || int(searchHeight) >= len(e.searchStack) {
+		return true
+	}
+	previous := e.searchStack[searchHeight-2].eval
+	return previous == -MAX_INT || eval > previous
+}
+
+func (e *Engine) setStaticEval(searchHeight int8, eval int32) {
+	if int(searchHeight) < len(e.searchStack) {
+		e.searchStack[searchHeight].eval = eval
+	}
+}
@@ -1,7 +1,9 @@
 package search
 
 import (
-	"fmt"
+	"context"
+	"math/rand"
+	"sync"
 	"time"
 
 	. "github.com/amanjpro/zahak/cache"
@@ -10,16 +12,33 @@ import (
 )
 
 type Engine struct {
-	nodesVisited   int64
-	cacheHits      int64
-	pv             *PVLine
-	StopSearchFlag bool
-	move           Move
-	score          int32
-	killerMoves    [][]Move
-	searchHistory  [][]int32
-	startTime      time.Time
-	ThinkTime      int64
+	nodesVisited  int64
+	cacheHits     int64
+	pv            *PVLine
+	control       *SearchControl
+	move          Move
+	score         int32
+	killerMoves   [][]Move
+	history       *History
+	verifyHeight  int8  // While a null move is verified, the verified side does not
+	verifyColor   Color // try null moves before this height
+	searchStack   []stackEntry
+	startTime     time.Time
+	nodeLimit     int64
+	Params        SearchParams
+	Skill         Skill
+	random        *rand.Rand
+	timeManager   *TimeManager
+	rootMoveNodes [64][64]int64 // The nodes spent on every root move, in the current iteration
+	helpers       []*Engine
+	isHelper      bool
+	listener      InfoListener
+	depth         int8          // The depth of the last finished iteration
+	unresolved    *SearchResult // The last iteration, when it is stopped before its aspiration window is resolved
+	selDepth      int8
+	contempt      int32
+	scaleContempt bool
+	rootColor     Color
 }
 
 func NewEngine() *Engine {
@@ -27,26 +46,76 @@ func NewEngine() *Engine {
 		0,
 		0,
 		NewPVLine(100),
-		false,
+		NewSearchControl(),
 		EmptyMove,
 		0,
 		make([][]Move, 125), // We assume there will be at most 126 iterations for each move/search
-		make([][]int32, 12), // We have 12 pieces only
+		&History{},
+		0,
+		White,
+		make([]stackEntry, MAX_SEARCH_HEIGHT),
 		time.Now(),
 		0,
+		NewSearchParams(),
+		NewSkill(MAX_SKILL_LEVEL),
+		rand.New(rand.NewSource(time.Now().UnixNano())),
+		nil,
+		[64][64]int64{},
+		nil,
+		false,
+		nil,
+		0,
+		nil,
+		0,
+		0,
+		false,
+		White,
 	}
 }
 
-func (e *Engine) ShouldStop() bool {
-	if e.StopSearchFlag {
-		return true
+// SetThreads configures the number of threads for Lazy SMP, the engine itself is
+// the main thread, and every other thread is a helper with its own killers and history
+func (e *Engine) SetThreads(threads int) {
+	if threads < 1 {
+		threads = 1
 	}
-	now := time.Now()
-	return now.Sub(e.startTime).Milliseconds() >= e.ThinkTime
+	e.helpers = make([]*Engine, threads-1)
+	for i := 0; i < len(e.helpers); i++ {
+		helper := NewEngine()
+		helper.isHelper = true
+		e.helpers[i] = helper
+	}
+}
+
+func (e *Engine) Threads() int {
+	return len(e.helpers) + 1
+}
+
+func (e *Engine) ShouldStop() bool {
+	return e.control.IsStopped()
+}
+
+// Arm prepares the engine for the next search, a Stop from now on stops that search,
+// even when it is called before the search starts
+func (e *Engine) Arm() {
+	e.control.Arm()
+}
+
+// Stop stops the running search, it is safe to call from any goroutine
+func (e *Engine) Stop() {
+	e.control.Stop()
 }
 
 var EmptyMove = Move{NoSquare, NoSquare, 0, 0}
 
+const ASPIRATION_WINDOW = int32(75)
+const MAX_ASPIRATION_WINDOW = int32(1000)
+const MIN_ASPIRATION_DEPTH = int8(5)
+const MIN_SINGULAR_DEPTH = int8(8)
+const SINGULAR_MARGIN = int32(2)
+const MIN_NULL_MOVE_DEPTH = int8(3)
+const MIN_NULL_MOVE_VERIFICATION_DEPTH = int8(10)
+
 func (e *Engine) ClearForSearch() {
 	for i := 0; i < len(e.killerMoves); i++ {
 		if e.killerMoves[i] == nil {
@@ -57,37 +126,19 @@ func (e *Engine) ClearForSearch() {
 		}
 	}
 
-	for i := 0; i < len(e.searchHistory); i++ {
-		if e.searchHistory[i] == nil {
-			e.searchHistory[i] = make([]int32, 64) // Number of Squares
-		}
-		for j := 0; j < len(e.searchHistory[i]); j++ {
-			e.searchHistory[i][j] = 0
-		}
-	}
+	e.history.Age()
 
-	e.StopSearchFlag = false
 	e.nodesVisited = 0
 	e.cacheHits = 0
+	e.depth = 0
+	e.unresolved = nil
+	e.selDepth = 0
 	e.pv.Pop() // pop our move
 	e.pv.Pop() // pop our opponent's move
 
 	e.startTime = time.Now()
 }
 
-func (e *Engine) KillerMoveScore(move Move, ply int8) int32 {
-	if e.killerMoves[ply] == nil {
-		return 0
-	}
-	if e.killerMoves[ply][0] != EmptyMove && e.killerMoves[ply][0] == move {
-		return 100_000
-	}
-	if e.killerMoves[ply][1] != EmptyMove && e.killerMoves[ply][1] == move {
-		return 90_000
-	}
-	return 0
-}
-
 func (e *Engine) AddKillerMove(move Move, ply int8) {
 	if !move.HasTag(Capture) {
 		e.killerMoves[ply][1] = e.killerMoves[ply][0]
@@ -95,22 +146,13 @@ func (e *Engine) AddKillerMove(move Move, ply int8) {
 	}
 }
 
-func (e *Engine) MoveHistoryScore(movingPiece Piece, destination Square, ply int8) int32 {
-	if e.searchHistory[movingPiece] == nil {
-		return 0
+// ClearHistory forgets everything that is learnt in the previous searches, for
+// when a new game starts
+func (e *Engine) ClearHistory() {
+	e.history.Clear()
+	for _, helper := range e.helpers {
+		helper.history.Clear()
 	}
-	return 60_000 + e.searchHistory[movingPiece][destination]
-}
-
-func (e *Engine) AddMoveHistory(move Move, movingPiece Piece, destination Square, ply int8) {
-	if !move.HasTag(Capture) {
-		e.searchHistory[movingPiece][destination] += int32(ply)
-	}
-}
-
-func (e *Engine) SendBestMove() {
-	mv := e.Move()
-	fmt.Printf("bestmove %s\n", mv.ToString())
 }
 
 func (e *Engine) Move() Move {
@@ -121,71 +163,229 @@ func (e *Engine) Score() int32 {
 	return e.score
 }
 
-func (e *Engine) SendPv() {
-	thinkTime := time.Now().Sub(e.startTime)
-	fmt.Printf("info depth %d nps %d tbhits %d hashfull %d nodes %d score cp %d time %d pv %s\n\n",
-		e.pv.moveCount, nps(e.nodesVisited, thinkTime.Seconds()),
-		e.cacheHits, TranspositionTable.Consumed(), e.nodesVisited, e.score,
-		thinkTime.Milliseconds(), e.pv.ToString())
-}
-
 func (e *Engine) VisitNode() {
 	e.nodesVisited += 1
+	if e.nodesVisited%NODES_PER_REPORT == 0 {
+		e.control.addNodes(NODES_PER_REPORT)
+	} else if e.nodeLimit > 0 && e.nodesVisited >= e.nodeLimit { // exact, for a single thread
+		e.control.Stop()
+	}
+}
+
+// The deepest height reached by the search, quiescence included
+func (e *Engine) updateSelDepth(searchHeight int8) {
+	if searchHeight > e.selDepth {
+		e.selDepth = searchHeight
+	}
 }
 
 func (e *Engine) CacheHit() {
 	e.cacheHits += 1
 }
 
-func (e *Engine) Search(position *Position, depth int8, ply uint16) {
+// Search searches the position until one of the limits is reached, Stop is called,
+// or the context is done
+func (e *Engine) Search(ctx context.Context, position *Position, limits Limits) SearchResult {
 	e.ClearForSearch()
-	e.rootSearch(position, depth, ply)
+	depth := limits.Depth
+	if depth <= 0 || depth > MAX_DEPTH {
+		depth = MAX_DEPTH
+	}
+	ply := limits.Ply
+	thinkTime := MAX_THINK_TIME
+	if limits.MoveTime > 0 || limits.Time > 0 {
+		isPerMove := limits.MoveTime > 0
+		available := limits.Time
+		if isPerMove {
+			available = limits.MoveTime
+		}
+		e.timeManager = NewTimeManager(available, isPerMove, limits.Increment, limits.MovesToGo, limits.MoveOverhead)
+		thinkTime = e.timeManager.MaximumTime()
+	}
+	nodeLimit := limits.Nodes
+	helpers := e.helpers
+	if e.Skill.IsLimited() { // A weakened engine searches alone
+		if depth > e.Skill.MaxDepth() {
+			depth = e.Skill.MaxDepth()
+		}
+		if nodeLimit == 0 || nodeLimit > e.Skill.MaxNodes() {
+			nodeLimit = e.Skill.MaxNodes()
+		}
+		helpers = nil
+	}
+	e.nodeLimit = nodeLimit
+	e.contempt = limits.Contempt
+	e.scaleContempt = limits.ScaleContempt
+	e.rootColor = position.Turn()
+	e.control.Start(ctx, thinkTime, nodeLimit)
+
+	// Lazy SMP: helpers search the same root on their own copy of the position,
+	// and only communicate with the main thread through the transposition table
+	var wg sync.WaitGroup
+	for i, helper := range helpers {
+		helper.ClearForSearch()
+		helper.startTime = e.startTime
+		helper.control = e.control
+		helper.Params = e.Params
+		helper.contempt = e.contempt
+		helper.scaleContempt = e.scaleContempt
+		helper.rootColor = e.rootColor
+		wg.Add(1)
+		go func(helper *Engine, position *Position, thread int) {
+			defer wg.Done()
+			helper.rootSearch(position, thread, depth, ply)
+		}(helper, position.Copy(), i+1)
+	}
+
+	if e.Skill.IsLimited() {
+		e.skillSearch(position, depth, ply)
+	} else {
+		e.rootSearch(position, 0, depth, ply)
+	}
+
+	e.control.Stop() // stops the helpers too
+	wg.Wait()
+	e.control.Finish()
+	e.timeManager = nil
+
+	nodes := e.nodesVisited
+	for _, helper := range helpers {
+		nodes += helper.nodesVisited
+	}
+	if e.unresolved != nil {
+		result := *e.unresolved
+		result.Nodes = nodes
+		result.Time = time.Now().Sub(e.startTime)
+		return result
+	}
+	result := e.newResult(position, e.depth, e.pv, e.score, Exact, nodes)
+	if e.depth == 0 { // Stopped before the first iteration, any legal move is better than none
+		if moves := position.LegalMoves(); len(moves) > 0 {
+			result.BestMove = moves[0]
+		}
+	}
+	return result
+}
+
+// Helpers skip some of the iterations, so that at any time they are spread
+// over several depths instead of all searching the same tree as the main thread.
+// Thread i skips skipSize[i] iterations out of every 2*skipSize[i], starting
+// at an offset of skipPhase[i], the main thread (thread 0) never skips.
+var skipSize = []int8{1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 3, 3, 4, 4, 4, 4, 4, 4, 4, 4}
+var skipPhase = []int8{0, 1, 0, 1, 2, 3, 0, 1, 2, 3, 4, 5, 0, 1, 2, 3, 4, 5, 6, 7}
+
+func skipIteration(thread int, iterationDepth int8) bool {
+	if thread == 0 {
+		return false
+	}
+	i := (thread - 1) % len(skipPhase)
+	return ((iterationDepth+skipPhase[i])/skipSize[i])%2 != 0
 }
 
-func (e *Engine) rootSearch(position *Position, depth int8, ply uint16) {
+func (e *Engine) rootSearch(position *Position, thread int, depth int8, ply uint16) {
 
 	var previousBestMove Move
-	alpha := -MAX_INT
-	beta := MAX_INT
+	previousScore := -MAX_INT
 
 	e.move = EmptyMove
-	e.score = alpha
-	fruitelessIterations := 0
+	e.score = -MAX_INT
+	bestMoveStability := 0
 
 	firstScore := true
 	for iterationDepth := int8(1); iterationDepth <= depth; iterationDepth++ {
 		if e.ShouldStop() {
 			break
 		}
-		line := NewPVLine(iterationDepth + 1)
-		score, ok := e.alphaBeta(position, iterationDepth, 0, alpha, beta, ply, line, true, true, 0)
-		if ok && (firstScore || line.moveCount >= e.pv.moveCount) {
-			e.pv = line
-			e.score = score
-			e.move = e.pv.MoveAt(0)
-			e.SendPv()
-			firstScore = false
-		}
-		if iterationDepth >= 20 && e.move == previousBestMove {
-			fruitelessIterations++
-			if fruitelessIterations > 4 {
+		if skipIteration(thread, iterationDepth) && iterationDepth < depth {
+			continue
+		}
+		iterationStart := time.Now()
+		iterationNodes := e.nodesVisited
+		e.rootMoveNodes = [64][64]int64{}
+
+		// Aspiration Window: the score is likely to stay close to the previous
+		// iteration's score, start with a narrow window and widen it on failures
+		alpha := -MAX_INT
+		beta := MAX_INT
+		delta := ASPIRATION_WINDOW
+		if !firstScore && iterationDepth >= MIN_ASPIRATION_DEPTH && abs32(e.score) < CHECKMATE_EVAL {
+			alpha = max32(e.score-delta, -MAX_INT)
+			beta = min32(e.score+delta, MAX_INT)
+		}
+
+		for {
+			line := NewPVLine(iterationDepth + 1)
+			score, ok := e.alphaBeta(position, iterationDepth, 0, alpha, beta, ply, line, true, true, 0, EmptyMove)
+			if !ok {
+				break
+			}
+			if score <= alpha && alpha != -MAX_INT { // fail-low
+				e.notifyIteration(position, iterationDepth, line, alpha, UpperBound)
+				e.setUnresolved(position, iterationDepth, e.pv, alpha, UpperBound)
+				beta = (alpha + beta) / 2
+				alpha = max32(score, -MAX_INT+delta) - delta
+			} else if score >= beta && beta != MAX_INT { // fail-high
+				if line.moveCount > 0 {
+					e.move = line.MoveAt(0)
+					e.setUnresolved(position, iterationDepth, line, beta, LowerBound)
+				}
+				e.notifyIteration(position, iterationDepth, line, beta, LowerBound)
+				beta = min32(score, MAX_INT-delta) + delta
+			} else {
+				e.pv = line
+				e.score = score
+				if line.moveCount > 0 {
+					e.move = line.MoveAt(0)
+				}
+				e.depth = iterationDepth
+				e.notifyIteration(position, iterationDepth, e.pv, e.score, Exact)
+				firstScore = false
+				e.unresolved = nil
 				break
 			}
+			delta += delta / 2
+			if delta > MAX_ASPIRATION_WINDOW { // Give up, and search with the full window
+				alpha = -MAX_INT
+				beta = MAX_INT
+			}
+		}
+
+		if e.move == previousBestMove {
+			bestMoveStability++
 		} else {
-			fruitelessIterations = 0
+			bestMoveStability = 0
 		}
 		if e.score == CHECKMATE_EVAL {
 			break
 		}
+		if e.timeManager != nil && !e.isHelper && e.move != EmptyMove && !e.ShouldStop() {
+			stats := IterationStats{
+				time.Now().Sub(e.startTime).Milliseconds(),
+				time.Now().Sub(iterationStart).Milliseconds(),
+				bestMoveStability,
+				0,
+				0,
+			}
+			if previousScore != -MAX_INT && e.score != -MAX_INT {
+				stats.ScoreDrop = previousScore - e.score
+			}
+			iterationNodes = e.nodesVisited - iterationNodes
+			if iterationNodes > 0 {
+				stats.BestMoveNodesFraction = float64(e.rootMoveNodes[e.move.Source][e.move.Destination]) / float64(iterationNodes)
+			}
+			if e.timeManager.ShouldStop(stats) {
+				break
+			}
+		}
 		previousBestMove = e.move
+		previousScore = e.score
 	}
-
-	e.SendPv()
 }
 
 func (e *Engine) alphaBeta(position *Position, depthLeft int8, searchHeight int8, alpha int32, beta int32, ply uint16, pvline *PVLine,
-	multiCutFlag bool, nullMove bool, inNullMoveSearch int8) (int32, bool) {
+	multiCutFlag bool, nullMove bool, inNullMoveSearch int8, excludedMove Move) (int32, bool) {
 	e.VisitNode()
+	e.updateSelDepth(searchHeight)
 
 	isRootNode := searchHeight == 0
 	isPvNode := alpha != beta-1
@@ -195,61 +395,78 @@ func (e *Engine) alphaBeta(position *Position, depthLeft int8, searchHeight int8
 		if outcome == Checkmate {
 			return -CHECKMATE_EVAL, true
 		} else if outcome == Draw {
-			return 0, true
+			return e.drawScore(position), true
 		}
-		return e.quiescence(position, alpha, beta, 0, Evaluate(position), searchHeight), true
+		return e.quiescence(position, alpha, beta, 0, Evaluate(position), searchHeight, ply), true
 	}
 
 	hash := position.Hash()
 	cachedEval, found := TranspositionTable.Get(hash)
-	if found && cachedEval.Depth >= depthLeft {
+	hashMove := EmptyMove
+	if found && cachedEval.Move != 0 {
+		hashMove = UnpackMove(cachedEval.Move)
+	}
+	isSingularSearch := excludedMove != EmptyMove
+	if !isRootNode && !isSingularSearch && found && cachedEval.Depth >= depthLeft {
 		score := cachedEval.Eval
-		if score >= beta && (cachedEval.Type == UpperBound || cachedEval.Type == Exact) {
+		if score >= beta && (cachedEval.Type == LowerBound || cachedEval.Type == Exact) {
 			e.CacheHit()
 			return beta, true
 		}
-		if score <= alpha && (cachedEval.Type == LowerBound || cachedEval.Type == Exact) {
+		if score <= alpha && (cachedEval.Type == UpperBound || cachedEval.Type == Exact) {
 			e.CacheHit()
 			return alpha, true
 		}
 	}
 
-	legalMoves := position.LegalMoves()
-
-	if len(legalMoves) == 0 {
-		outcome := position.Status()
-		if outcome == Checkmate {
-			return -CHECKMATE_EVAL, true
-		} else if outcome == Draw {
-			return 0, true
-		}
-	} else if position.IsFIDEDrawRule() { // an optimization to not call isInCheck much
-		return 0, true
+	if position.IsFIDEDrawRule() {
+		return e.drawScore(position), true
 	}
 
-	movePicker := NewMovePicker(position, e, legalMoves, searchHeight)
+	if isSingularSearch {
+		hashMove = excludedMove
+	}
+	movePicker := NewMovePicker(position, e, hashMove, searchHeight, false)
+	if isSingularSearch {
+		movePicker.skipHashMove()
+	}
 
 	if e.ShouldStop() {
 		return -MAX_INT, false
 	}
 
-	isInCheck := false
-	if !isRootNode && !isPvNode { // only compute it if it is not pv-node
-		isInCheck = position.IsInCheck()
+	isInCheck := position.IsInCheck()
+
+	if isInCheck && !isRootNode {
+		depthLeft += 1 // Check Extension
 	}
 
-	if isInCheck {
-		depthLeft += 1 // Singular Extension
+	// Internal Iterative Reduction: without a hash move the move ordering is poor, and
+	// the node is likely not searched before, it is cheaper to search it a bit shallower.
+	// Multi-cut nodes are the expected cut nodes
+	if !isRootNode && (isPvNode || multiCutFlag) && hashMove == EmptyMove && depthLeft >= e.Params.IIRMinDepth {
+		depthLeft -= 1
 	}
 
 	eval := Evaluate(position)
+	improving := false
+	if isInCheck {
+		e.setStaticEval(searchHeight, -MAX_INT)
+	} else {
+		e.setStaticEval(searchHeight, eval)
+		improving = e.isImproving(searchHeight, eval)
+	}
 
-	// NullMove pruning
 	R := int8(3)
 	if searchHeight > 6 {
 		R = 2
 	}
-	isNullMoveAllowed := !isRootNode && !isPvNode && nullMove && depthLeft >= R+2 && !position.IsEndGame() && !isInCheck && eval >= beta
+
+	// NullMove pruning, it is unsafe when the side to move has only king and pawns,
+	// as zugzwang is common in such positions
+	isNullMoveAllowed := !isRootNode && !isPvNode && !isSingularSearch && nullMove && depthLeft >= MIN_NULL_MOVE_DEPTH &&
+		position.HasNonPawnMaterial() && !isInCheck && eval >= beta &&
+		(searchHeight >= e.verifyHeight || position.Turn() != e.verifyColor)
 
 	if isNullMoveAllowed {
 		bound := beta
@@ -257,31 +474,91 @@ func (e *Engine) alphaBeta(position *Position, depthLeft int8, searchHeight int8
 			tempo := int32(15)   // TODO: Make it variable with a formula like: 10*(numPGAM > 0) + 10* numPGAM > 15);
 			bound = beta - tempo // variable bound
 		}
+		// The reduction grows with the depth, and with how far the eval is above beta
+		nullR := 3 + depthLeft/6 + int8(min32((eval-beta)/200, 3))
+		nullDepth := depthLeft - 1 - nullR
+		if nullDepth < 0 {
+			nullDepth = 0
+		}
+		e.pushMove(searchHeight, EmptyMove, NoPiece)
 		ep := position.MakeNullMove()
 		newBeta := 1 - bound
-		line := NewPVLine(depthLeft - 1 - R)
-		score, ok := e.alphaBeta(position, depthLeft-R-1, searchHeight+1, newBeta-1, newBeta, ply, line, !multiCutFlag, false, inNullMoveSearch+1)
+		line := NewPVLine(nullDepth + 1)
+		score, ok := e.alphaBeta(position, nullDepth, searchHeight+1, newBeta-1, newBeta, ply, line, !multiCutFlag, false, inNullMoveSearch+1, EmptyMove)
 		score = -score
 		position.UnMakeNullMove(ep)
 		if !ok {
 			return score, false
 		}
 		if score >= bound {
-			return beta, true // null move pruning
+			if depthLeft < MIN_NULL_MOVE_VERIFICATION_DEPTH || e.verifyHeight != 0 {
+				return beta, true // null move pruning
+			}
+			// Verification search: at high depths, make sure that the position is not a
+			// zugzwang by searching it again, the side to move does not try null moves
+			// in most of the verification, not only at its root
+			e.verifyHeight = searchHeight + nullDepth - nullDepth/4
+			e.verifyColor = position.Turn()
+			line.Recycle()
+			score, ok = e.alphaBeta(position, nullDepth, searchHeight, beta-1, beta, ply, line, multiCutFlag, false, inNullMoveSearch, EmptyMove)
+			e.verifyHeight = 0
+			if !ok {
+				return score, false
+			}
+			if score >= beta {
+				return beta, true
+			}
+		}
+	}
+
+	// ProbCut: if a good capture beats beta by a margin in a reduced search, the full
+	// depth search would very likely beat beta too
+	probBeta := beta + e.Params.ProbCutMargin
+	if !isRootNode && !isPvNode && !isSingularSearch && !isInCheck && depthLeft >= e.Params.ProbCutMinDepth &&
+		abs32(beta) < CHECKMATE_EVAL &&
+		!(found && cachedEval.Depth >= depthLeft-3 && cachedEval.Eval < probBeta) {
+		probDepth := depthLeft - e.Params.ProbCutReduction
+		capturePicker := NewMovePicker(position, e, hashMove, searchHeight, true)
+		for move := capturePicker.Next(); move != EmptyMove; move = capturePicker.Next() {
+			if !position.SeeAtLeast(move, probBeta-eval) {
+				continue
+			}
+			e.pushMove(searchHeight, move, position.Board.PieceAt(move.Source))
+			capturedPiece, oldEnPassant, oldTag, hc := position.MakeMove(move)
+			// A quiescence search first, to discard the captures that obviously fail
+			score := -e.quiescence(position, -probBeta, -probBeta+1, 0, Evaluate(position), searchHeight+1, ply)
+			ok := true
+			if score >= probBeta && probDepth > 0 {
+				line := NewPVLine(probDepth)
+				score, ok = e.alphaBeta(position, probDepth, searchHeight+1, -probBeta, -probBeta+1, ply, line, !multiCutFlag, true, inNullMoveSearch, EmptyMove)
+				score = -score
+			}
+			position.UnMakeMove(move, oldTag, oldEnPassant, capturedPiece, hc)
+			if !ok {
+				return score, ok
+			}
+			if score >= probBeta {
+				TranspositionTable.Set(hash, CachedEval{hash, score, probDepth + 1, LowerBound, ply, move.Pack()})
+				return score, true
+			}
 		}
 	}
 
 	// Multi-Cut Pruning
 	M := 6
 	C := 3
-	if !isRootNode && !isPvNode && depthLeft >= R+2 && multiCutFlag && len(legalMoves) > M {
+	if !isRootNode && !isPvNode && !isSingularSearch && depthLeft >= R+2 && multiCutFlag {
 		cutNodeCounter := 0
 		for i := 0; i < M; i++ {
 			move := movePicker.Next()
+			if move == EmptyMove {
+				break
+			}
+			e.pushMove(searchHeight, move, position.Board.PieceAt(move.Source))
 			capturedPiece, oldEnPassant, oldTag, hc := position.MakeMove(move)
 			line := NewPVLine(depthLeft - 1 - R)
 			newBeta := 1 - beta
-			score, ok := e.alphaBeta(position, depthLeft-1-R, searchHeight+1, newBeta-1, newBeta, ply, line, !multiCutFlag, true, inNullMoveSearch)
+			score, ok := e.alphaBeta(position, depthLeft-1-R, searchHeight+1, newBeta-1, newBeta, ply, line, !multiCutFlag, true, inNullMoveSearch, EmptyMove)
 			score = -score
 			position.UnMakeMove(move, oldTag, oldEnPassant, capturedPiece, hc)
 			if !ok {
@@ -303,81 +580,170 @@ func (e *Engine) alphaBeta(position *Position, depthLeft int8, searchHeight int8
 
 	// Razoring
 	if !isRootNode && !isPvNode && depthLeft < 2 && eval+margin < beta-1 {
-		return e.quiescence(position, alpha, beta, 0, eval, searchHeight), true
+		return e.quiescence(position, alpha, beta, 0, eval, searchHeight, ply), true
 	}
 
 	// Reverse Futility Pruning
-	if !isRootNode && !isPvNode && depthLeft < 5 && eval-margin >= beta {
+	if !isRootNode && !isPvNode && !isSingularSearch && depthLeft < 5 && eval-margin >= beta {
 		return eval - margin, true /* fail soft */
 	}
 
-	// Extended Futility Pruning
-	reductionsAllowed := !isRootNode && !isPvNode && !isInCheck
+	pruningAllowed := !isRootNode && !isPvNode && !isInCheck
+
+	// Singular Extension: if the hash move is much better than all the alternatives,
+	// searched with a reduced depth, it is worth searching deeper
+	extension := int8(0)
+	if !isRootNode && !isSingularSearch && depthLeft >= MIN_SINGULAR_DEPTH && hashMove != EmptyMove &&
+		(cachedEval.Type == LowerBound || cachedEval.Type == Exact) && cachedEval.Depth >= depthLeft-3 &&
+		abs32(cachedEval.Eval) < CHECKMATE_EVAL {
+		singularBeta := cachedEval.Eval - SINGULAR_MARGIN*int32(depthLeft)
+		line := NewPVLine(depthLeft)
+		score, ok := e.alphaBeta(position, (depthLeft-1)/2, searchHeight, singularBeta-1, singularBeta, ply, line, multiCutFlag, nullMove, inNullMoveSearch, hashMove)
+		if !ok {
+			return score, ok
+		}
+		if score < singularBeta {
+			extension = 1
+		} else if singularBeta >= beta {
+			// Multi-Cut: even without the hash move, at least another move beats beta
+			return singularBeta, true
+		} else if cachedEval.Eval >= beta {
+			extension = -1 // Negative Extension
+		}
+	}
 
 	movePicker.Reset()
 
-	hasSeenExact := false
+	originalAlpha := alpha
 
 	// using fail soft with negamax:
 	bestscore := -MAX_INT
 	move := movePicker.Next()
+	if move == EmptyMove { // No legal moves, checkmate or stalemate
+		if isSingularSearch { // The excluded move is the only move
+			return alpha, true
+		}
+		if isInCheck {
+			return -CHECKMATE_EVAL, true
+		}
+		return e.drawScore(position), true
+	}
+	bestMove := move
+	quietsSearched := make([]Move, 0, 32)
+	nodesBefore := e.nodesVisited
+	if isRootNode {
+		e.notifyRootMove(depthLeft, move, 1)
+	}
+	e.pushMove(searchHeight, move, position.Board.PieceAt(move.Source))
 	capturedPiece, oldEnPassant, oldTag, hc := position.MakeMove(move)
+	firstMoveDepth := depthLeft - 1
+	if move == hashMove {
+		firstMoveDepth += extension
+	}
 	line := NewPVLine(depthLeft - 1)
-	score, ok := e.alphaBeta(position, depthLeft-1, searchHeight+1, -beta, -alpha, ply, line, !multiCutFlag, true, inNullMoveSearch)
+	score, ok := e.alphaBeta(position, firstMoveDepth, searchHeight+1, -beta, -alpha, ply, line, !multiCutFlag, true, inNullMoveSearch, EmptyMove)
 	bestscore = -score
 	position.UnMakeMove(move, oldTag, oldEnPassant, capturedPiece, hc)
 	if !ok {
 		return bestscore, ok
 	}
+	if isRootNode {
+		e.rootMoveNodes[move.Source][move.Destination] += e.nodesVisited - nodesBefore
+	}
 	if bestscore > alpha {
 		if bestscore >= beta {
 			// Those scores are never useful
-			if bestscore != -MAX_INT && bestscore != MAX_INT {
-				TranspositionTable.Set(hash, CachedEval{hash, bestscore, depthLeft, UpperBound, ply})
+			if bestscore != -MAX_INT && bestscore != MAX_INT && !isSingularSearch {
+				TranspositionTable.Set(hash, CachedEval{hash, bestscore, depthLeft, LowerBound, ply, move.Pack()})
+			}
+			if isRootNode {
+				pvline.AddFirst(move)
+				pvline.ReplaceLine(line)
 			}
 			e.AddKillerMove(move, searchHeight)
+			e.AddHistory(position, move, searchHeight, depthLeft, quietsSearched)
 			return bestscore, true
 		}
 		alpha = bestscore
 		pvline.AddFirst(move)
 		pvline.ReplaceLine(line)
-		hasSeenExact = true
-		e.AddMoveHistory(move, position.Board.PieceAt(move.Source), move.Destination, searchHeight)
+	}
+	if !move.HasTag(Capture) {
+		quietsSearched = append(quietsSearched, move)
 	}
 
-	for i := 1; i < len(legalMoves); i++ {
+	for i := 1; ; i++ {
 		line.Recycle()
 		move := movePicker.Next()
+		if move == EmptyMove {
+			break
+		}
 		if isRootNode {
-			fmt.Printf("info currmove %s currmovenumber %d\n\n", move.ToString(), i+1)
+			e.notifyRootMove(depthLeft, move, i+1)
 		}
 
-		LMR := int8(0)
-		if reductionsAllowed && searchHeight >= 6 && depthLeft == 2 {
+		movingPiece := position.Board.PieceAt(move.Source)
+		isCheckMove := move.HasTag(Check)
+		isQuiet := !move.HasTag(Capture) && move.PromoType == NoType
 
-			// Extended Futility Pruning
-			gain := Evaluate(position) + futility
-			isCheckMove := move.HasTag(Check)
+		// Extended Futility Pruning
+		if pruningAllowed && searchHeight >= 6 && depthLeft == 2 {
+			gain := eval + futility
 			if gain <= alpha && !isCheckMove && move.PromoType == NoType {
 				continue
 			}
+		}
+
+		// Late Move Pruning, at shallow depths only the first few quiet moves are searched
+		if pruningAllowed && isQuiet && !isCheckMove && depthLeft <= MAX_LMP_DEPTH && bestscore > -CHECKMATE_EVAL &&
+			len(quietsSearched) >= lateMovePruningCount(depthLeft, improving) {
+			continue
+		}
 
-			// Late Move Reduction
-			if i >= 5 && !isCheckMove && move.PromoType == NoType {
-				LMR = 1
+		// Late Move Reduction
+		LMR := int8(0)
+		if !isRootNode && !isInCheck && isQuiet && depthLeft >= 3 && i >= 2 {
+			LMR = lmrReduction(depthLeft, i+1)
+			if isPvNode {
+				LMR -= 1
+			}
+			if !improving {
+				LMR += 1
+			}
+			if isCheckMove {
+				LMR -= 1
+			}
+			LMR -= int8(e.QuietHistory(move, movingPiece, searchHeight) / 8192)
+			if LMR < 0 {
+				LMR = 0
+			} else if LMR > depthLeft-2 {
+				LMR = depthLeft - 2
 			}
 		}
+
+		nodesBefore := e.nodesVisited
+		e.pushMove(searchHeight, move, movingPiece)
 		capturedPiece, oldEnPassant, oldTag, hc := position.MakeMove(move)
-		score, ok := e.alphaBeta(position, depthLeft-1-LMR, searchHeight+1, -alpha-1, -alpha, ply, line, !multiCutFlag, true, inNullMoveSearch)
+		score, ok := e.alphaBeta(position, depthLeft-1-LMR, searchHeight+1, -alpha-1, -alpha, ply, line, !multiCutFlag, true, inNullMoveSearch, EmptyMove)
 		score = -score
 		if !ok {
 			position.UnMakeMove(move, oldTag, oldEnPassant, capturedPiece, hc)
 			return score, ok
 		}
+		if score > alpha && LMR > 0 {
+			line.Recycle()
+			// the reduced search failed high, verify it with the full depth
+			score, ok = e.alphaBeta(position, depthLeft-1, searchHeight+1, -alpha-1, -alpha, ply, line, !multiCutFlag, true, inNullMoveSearch, EmptyMove)
+			score = -score
+			if !ok {
+				position.UnMakeMove(move, oldTag, oldEnPassant, capturedPiece, hc)
+				return score, ok
+			}
+		}
 		if score > alpha && score < beta {
 			line.Recycle()
 			// research with window [alpha;beta]
-			score, ok = e.alphaBeta(position, depthLeft-1-LMR, searchHeight+1, -beta, -alpha, ply, line, !multiCutFlag, true, inNullMoveSearch)
+			score, ok = e.alphaBeta(position, depthLeft-1, searchHeight+1, -beta, -alpha, ply, line, !multiCutFlag, true, inNullMoveSearch, EmptyMove)
 			score = -score
 			if !ok {
 				position.UnMakeMove(move, oldTag, oldEnPassant, capturedPiece, hc)
@@ -388,38 +754,45 @@ func (e *Engine) alphaBeta(position *Position, depthLeft int8, searchHeight int8
 			}
 		}
 		position.UnMakeMove(move, oldTag, oldEnPassant, capturedPiece, hc)
+		if isRootNode {
+			e.rootMoveNodes[move.Source][move.Destination] += e.nodesVisited - nodesBefore
+		}
 
 		if score > bestscore { //}||
 			// (score == CHECKMATE_EVAL && score >= alpha &&
 			// (pvline == nil || pvline.moveCount < line.moveCount+1)) { // shorter checkmate?
 			if score >= beta {
 				// Those scores are never useful
-				if score != -MAX_INT && score != MAX_INT {
-					TranspositionTable.Set(hash, CachedEval{hash, score, depthLeft, UpperBound, ply})
+				if score != -MAX_INT && score != MAX_INT && !isSingularSearch {
+					TranspositionTable.Set(hash, CachedEval{hash, score, depthLeft, LowerBound, ply, move.Pack()})
+				}
+				if isRootNode {
+					pvline.AddFirst(move)
+					pvline.ReplaceLine(line)
 				}
 				e.AddKillerMove(move, searchHeight)
+				e.AddHistory(position, move, searchHeight, depthLeft, quietsSearched)
 				return score, ok
 			}
 
 			bestscore = score
+			bestMove = move
 			// Potential PV move, lets copy it to the current pv-line
 			pvline.AddFirst(move)
 			pvline.ReplaceLine(line)
-			hasSeenExact = true
-			e.AddMoveHistory(move, position.Board.PieceAt(move.Source), move.Destination, searchHeight)
+		}
+		if !move.HasTag(Capture) {
+			quietsSearched = append(quietsSearched, move)
 		}
 	}
-	if hasSeenExact {
-		TranspositionTable.Set(hash, CachedEval{hash, alpha, depthLeft, Exact, ply})
+	if isSingularSearch {
+		return bestscore, true
+	}
+	// Only a move that raises alpha makes the score exact, otherwise it is an upper bound
+	if bestscore > originalAlpha {
+		TranspositionTable.Set(hash, CachedEval{hash, bestscore, depthLeft, Exact, ply, bestMove.Pack()})
 	} else {
-		TranspositionTable.Set(hash, CachedEval{hash, bestscore, depthLeft, LowerBound, ply})
+		TranspositionTable.Set(hash, CachedEval{hash, bestscore, depthLeft, UpperBound, ply, 0})
 	}
 	return bestscore, true
 }
-
-func nps(nodes int64, dur float64) int64 {
-	if dur == 0 {
-		return 0
-	}
-	return int64(float64(nodes) / 1000 * dur)
-}
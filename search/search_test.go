@@ -1,9 +1,13 @@
 package search
 
 import (
+	"context"
 	"fmt"
+	"math/rand"
 	"testing"
+	"time"
 
+	. "github.com/amanjpro/zahak/cache"
 	. "github.com/amanjpro/zahak/engine"
 	. "github.com/amanjpro/zahak/evaluation"
 )
@@ -11,8 +15,7 @@ import (
 func TestBlackShouldFindEscape(t *testing.T) {
 	game := FromFen("3rbbn1/BQ1kp3/2p1q2p/N4p2/8/3P4/P1P2PPP/5RK1 b - - 0 27", true)
 	e := NewEngine()
-	e.ThinkTime = 400_000
-	e.Search(game.Position(), 7, 27)
+	e.Search(context.Background(), game.Position(), Limits{Depth: 7, Ply: 27})
 	expected := Move{D7, D6, NoType, 0}
 	mv := e.Move()
 	mvStr := mv.ToString()
@@ -24,8 +27,7 @@ func TestBlackShouldFindEscape(t *testing.T) {
 func TestBlackCanFindASimpleTactic(t *testing.T) {
 	game := FromFen("3N1k2/N7/1p2ppR1/1P6/P2pP3/3Pb3/2r4n/3K4 b - - 0 1", true)
 	e := NewEngine()
-	e.ThinkTime = 400_000
-	e.Search(game.Position(), 7, 1)
+	e.Search(context.Background(), game.Position(), Limits{Depth: 7, Ply: 1})
 	expected := Move{C2, D2, NoType, Check}
 	mv := e.Move()
 	mvStr := mv.ToString()
@@ -37,8 +39,7 @@ func TestBlackCanFindASimpleTactic(t *testing.T) {
 func TestBlackCanFindASimpleMaterialGainWithDiscoveredCheck(t *testing.T) {
 	game := FromFen("3N1k2/N7/1p2ppR1/1P6/P2pP3/3Pb3/3r3n/2K5 b - - 1 1", true)
 	e := NewEngine()
-	e.ThinkTime = 400_000
-	e.Search(game.Position(), 7, 1)
+	e.Search(context.Background(), game.Position(), Limits{Depth: 7, Ply: 1})
 	expected := Move{D2, G2, NoType, Check}
 	mv := e.Move()
 	mvStr := mv.ToString()
@@ -50,8 +51,7 @@ func TestBlackCanFindASimpleMaterialGainWithDiscoveredCheck(t *testing.T) {
 func TestWhiteShouldAcceptMaterialLossToAvoidCheckmate(t *testing.T) {
 	game := FromFen("3N1k2/N7/1p2ppR1/1P6/P2pP3/3Pb3/3r3n/3K4 w - - 0 1", true)
 	e := NewEngine()
-	e.ThinkTime = 400_000
-	e.Search(game.Position(), 7, 1)
+	e.Search(context.Background(), game.Position(), Limits{Depth: 7, Ply: 1})
 	expected := Move{D1, C1, NoType, 0}
 	mv := e.Move()
 	mvStr := mv.ToString()
@@ -63,8 +63,7 @@ func TestWhiteShouldAcceptMaterialLossToAvoidCheckmate(t *testing.T) {
 func TestSearchOnlyMove(t *testing.T) {
 	game := FromFen("rnbqkbnr/ppppp1p1/7p/5P1Q/8/8/PPPP1PPP/RNB1KBNR b KQkq - 0 1", true)
 	e := NewEngine()
-	e.ThinkTime = 400_000
-	e.Search(game.Position(), 7, 1)
+	e.Search(context.Background(), game.Position(), Limits{Depth: 7, Ply: 1})
 	expected := Move{G7, G6, NoType, 0}
 	mv := e.Move()
 	score := e.Score()
@@ -80,8 +79,7 @@ func TestSearchOnlyMove(t *testing.T) {
 func TestWhiteCanFindMateInTwo(t *testing.T) {
 	game := FromFen("3N1k2/N7/1p2ppR1/1P6/P2pP3/3Pbn2/3r4/4K3 w - - 2 2", true)
 	e := NewEngine()
-	e.ThinkTime = 400_000
-	e.Search(game.Position(), 7, 1)
+	e.Search(context.Background(), game.Position(), Limits{Depth: 7, Ply: 1})
 	expected := Move{E1, F1, NoType, 0}
 	mv := e.Move()
 	mvStr := mv.ToString()
@@ -141,3 +139,537 @@ func TestNestedMakeUnMake(t *testing.T) {
 		t.Errorf("Nested Make/UnMake broke hashing %s", fmt.Sprintf("Got: %d\nExpected: %d\n", endHash, originalHash))
 	}
 }
+
+func TestLazySMPCanFindASimpleTactic(t *testing.T) {
+	game := FromFen("3N1k2/N7/1p2ppR1/1P6/P2pP3/3Pb3/2r4n/3K4 b - - 0 1", true)
+	e := NewEngine()
+	e.SetThreads(4)
+	e.Search(context.Background(), game.Position(), Limits{Depth: 7, Ply: 1})
+	expected := Move{C2, D2, NoType, Check}
+	mv := e.Move()
+	mvStr := mv.ToString()
+	if mv != expected {
+		t.Errorf("Unexpected move was played:%s\n", fmt.Sprintf("Expected: %s\nGot: %s\n", expected.ToString(), mvStr))
+	}
+}
+
+func TestAspirationWindowIsWidenedAfterAFailHigh(t *testing.T) {
+	// The mate is only seen at depth 5, way above the window around the score of depth 4
+	game := FromFen("r5rk/5p1p/5R2/4B3/8/8/7P/7K w - - 0 1", true)
+	e := NewEngine()
+	listener := &recordingListener{}
+	e.SetInfoListener(listener)
+	result := e.Search(context.Background(), game.Position(), Limits{Depth: 8, Ply: 1})
+
+	failedHigh := false
+	for _, info := range listener.iterations {
+		failedHigh = failedHigh || info.Bound == LowerBound
+	}
+	if !failedHigh {
+		t.Errorf("Expected the search to fail high")
+	}
+	if result.Bound != Exact || result.Score != CHECKMATE_EVAL {
+		t.Errorf("Unexpected eval was returned:%s\n", fmt.Sprintf("Expected: %d\nGot: %d\n", CHECKMATE_EVAL, result.Score))
+	}
+	if len(result.PV) == 0 || result.BestMove != result.PV[0] {
+		t.Errorf("The move does not match the principal variation:%s\n", fmt.Sprintf("Move: %s\nPV: %v\n", result.BestMove.ToString(), result.PV))
+	}
+}
+
+func TestMovePickerReturnsEveryLegalMoveOnce(t *testing.T) {
+	game := FromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", true)
+	position := game.Position()
+	e := NewEngine()
+	e.ClearForSearch()
+	hashMove := Move{E2, A6, NoType, Capture}
+	e.AddKillerMove(Move{E1, G1, NoType, KingSideCastle}, 3)
+	e.AddKillerMove(Move{A1, A8, NoType, 0}, 3) // not a legal move
+
+	mp := NewMovePicker(position, e, hashMove, 3, false)
+	if mv := mp.Next(); mv != hashMove {
+		t.Errorf("Expected the hash move first, got: %s", mv.ToString())
+	}
+	seen := make(map[Move]int)
+	seen[hashMove] += 1
+	for mv := mp.Next(); mv != EmptyMove; mv = mp.Next() {
+		seen[mv] += 1
+	}
+	legalMoves := position.LegalMoves()
+	if len(seen) != len(legalMoves) {
+		t.Errorf("Expected %d moves, got %d", len(legalMoves), len(seen))
+	}
+	for _, mv := range legalMoves {
+		if seen[mv] != 1 {
+			t.Errorf("Move %s is returned %d times", mv.ToString(), seen[mv])
+		}
+	}
+
+	mp.Reset()
+	if mv := mp.Next(); mv != hashMove {
+		t.Errorf("Expected the hash move first after reset, got: %s", mv.ToString())
+	}
+}
+
+func TestHistoryIsBoundedAndPenalizesFailedQuiets(t *testing.T) {
+	game := FromFen("rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2", true)
+	position := game.Position()
+	e := NewEngine()
+	e.ClearForSearch()
+	e.pushMove(0, Move{E7, E5, NoType, 0}, BlackPawn)
+	good := Move{G1, F3, NoType, 0}
+	bad := Move{B1, C3, NoType, 0}
+	for i := 0; i < 1000; i++ {
+		e.AddHistory(position, good, 1, 30, []Move{bad})
+	}
+
+	goodScore := e.QuietHistory(good, WhiteKnight, 1)
+	badScore := e.QuietHistory(bad, WhiteKnight, 1)
+	if goodScore <= 0 || goodScore > 3*MAX_HISTORY {
+		t.Errorf("Unexpected history for a move that always cuts: %d", goodScore)
+	}
+	if badScore >= 0 || badScore < -3*MAX_HISTORY {
+		t.Errorf("Unexpected history for a move that never cuts: %d", badScore)
+	}
+	if counterMove := e.CounterMove(1); counterMove != good {
+		t.Errorf("Expected %s as the counter-move, got: %s", good.ToString(), counterMove.ToString())
+	}
+}
+
+func TestLateMoveReductionsGrowWithDepthAndMoveNumber(t *testing.T) {
+	for depth := int8(2); depth < 64; depth++ {
+		for moveNumber := 2; moveNumber < 64; moveNumber++ {
+			r := lmrReduction(depth, moveNumber)
+			if r < lmrReduction(depth-1, moveNumber) || r < lmrReduction(depth, moveNumber-1) {
+				t.Errorf("Reduction shrinks at depth %d and move %d", depth, moveNumber)
+			}
+		}
+	}
+	if lmrReduction(1, 1) != 0 {
+		t.Errorf("The first move should never be reduced")
+	}
+	if lateMovePruningCount(3, false) >= lateMovePruningCount(3, true) {
+		t.Errorf("Expected to prune more when the position is not improving")
+	}
+}
+
+func TestTranspositionTableBounds(t *testing.T) {
+	game := FromFen("4k3/8/8/8/8/8/8/3QK3 w - - 0 1", true)
+	position := game.Position()
+	e := NewEngine()
+	e.ClearForSearch()
+
+	windows := []struct {
+		alpha, beta int32
+		expected    NodeType
+	}{
+		{-2001, -2000, LowerBound}, // The queen is worth more, the search fails high
+		{5000, 5001, UpperBound},   // Every move fails low
+		{-5000, 5000, Exact},
+	}
+	for _, window := range windows {
+		ResetCache()
+		line := NewPVLine(4)
+		score, ok := e.alphaBeta(position, 3, 0, window.alpha, window.beta, 1, line, true, true, 0, EmptyMove)
+		cached, found := TranspositionTable.Get(position.Hash())
+		if !ok || !found || cached.Type != window.expected || cached.Eval != score {
+			t.Errorf("Expected a %d entry for [%d, %d], got %d with %d (score %d)",
+				window.expected, window.alpha, window.beta, cached.Type, cached.Eval, score)
+		}
+	}
+}
+
+func TestSingularSearchExcludesTheMove(t *testing.T) {
+	// The king has a single legal move
+	game := FromFen("k7/P7/8/8/8/8/8/1R5K b - - 0 1", true)
+	position := game.Position()
+	legalMoves := position.LegalMoves()
+	if len(legalMoves) != 1 {
+		t.Fatalf("Expected a single legal move, got %d", len(legalMoves))
+	}
+	e := NewEngine()
+	e.ClearForSearch()
+	line := NewPVLine(4)
+	score, ok := e.alphaBeta(position, 3, 1, 99, 100, 1, line, true, true, 0, legalMoves[0])
+	if !ok || score != 99 {
+		t.Errorf("Expected the exclusion search to fail low, got: %d", score)
+	}
+}
+
+func TestSingularSearchMultiCut(t *testing.T) {
+	// Up a queen, every move beats beta, not only the hash move
+	game := FromFen("4k3/8/8/8/8/8/8/3QK3 w - - 0 1", true)
+	position := game.Position()
+	hashMove := Move{D1, D4, NoType, 0}
+	depth := MIN_SINGULAR_DEPTH
+	beta := int32(500)
+	e := NewEngine()
+	e.ClearForSearch()
+
+	// search returns the score, and the depth of the entry that is left in the table
+	search := func(cachedScore int32) (int32, int8) {
+		ResetCache()
+		TranspositionTable.Set(position.Hash(), CachedEval{position.Hash(), cachedScore, depth - 1, LowerBound, 1, hashMove.Pack()})
+		line := NewPVLine(depth + 1)
+		score, ok := e.alphaBeta(position, depth, 1, beta-1, beta, 1, line, false, false, 0, EmptyMove)
+		cached, found := TranspositionTable.Get(position.Hash())
+		if !ok || !found {
+			t.Fatal("Expected the search to finish, and to leave an entry")
+		}
+		return score, cached.Depth
+	}
+
+	// The singular beta is beta, the other moves beat it and the node is cut before it
+	// is searched
+	if score, cachedDepth := search(beta + SINGULAR_MARGIN*int32(depth)); score != beta || cachedDepth != depth-1 {
+		t.Errorf("Expected a multi-cut at %d, got: %d, with an entry of depth %d", beta, score, cachedDepth)
+	}
+	// The singular beta is just below beta, the node is searched
+	if score, cachedDepth := search(beta + SINGULAR_MARGIN*int32(depth) - 1); score < beta || cachedDepth != depth {
+		t.Errorf("Expected the node to be searched and to fail high, got: %d, with an entry of depth %d", score, cachedDepth)
+	}
+}
+
+func TestNullMoveDoesNotHideZugzwang(t *testing.T) {
+	// Trebuchet, whoever moves has to give up their pawn
+	for _, fen := range []string{
+		"8/8/8/2Kp4/3Pk3/8/8/8 w - - 0 1",
+		"8/8/8/2Kp4/3Pk3/8/8/8 b - - 0 1",
+	} {
+		game := FromFen(fen, true)
+		e := NewEngine()
+		e.Search(context.Background(), game.Position(), Limits{Depth: 12, Ply: 1})
+		if e.Score() >= 0 {
+			t.Errorf("Expected the side to move to be losing in %s, got: %d", fen, e.Score())
+		}
+	}
+}
+
+func TestNullMoveVerificationFindsZugzwangWithPieces(t *testing.T) {
+	// Trebuchet again, the bishop of the side to move cannot move, but it allows null
+	// moves. Passing would keep the extra piece, any move gives up the pawn on d5 or d4
+	for _, fen := range []string{
+		"b7/1p6/1P6/2Kp4/3Pk3/8/8/8 b - - 0 1",
+		"8/8/8/3pK3/2kP4/1p6/1P6/B7 w - - 0 1",
+	} {
+		game := FromFen(fen, true)
+		position := game.Position()
+		if !position.HasNonPawnMaterial() {
+			t.Fatalf("Expected the side to move to have a piece in %s", fen)
+		}
+		e := NewEngine()
+		e.ClearForSearch()
+		line := NewPVLine(MIN_NULL_MOVE_VERIFICATION_DEPTH + 1)
+		score, ok := e.alphaBeta(position, MIN_NULL_MOVE_VERIFICATION_DEPTH, 1, -1, 0, 1, line, false, true, 0, EmptyMove)
+		if !ok || score >= 0 {
+			t.Errorf("Expected the verification search to refute the null move in %s, got: %d", fen, score)
+		}
+	}
+}
+
+func TestNullMoveIsNotTriedByTheVerifiedSide(t *testing.T) {
+	// The same zugzwang is too deep to be verified, the null move hides it unless the
+	// side to move is being verified
+	game := FromFen("b7/1p6/1P6/2Kp4/3Pk3/8/8/8 b - - 0 1", true)
+	position := game.Position()
+	search := func(verifyHeight int8, verifyColor Color) int32 {
+		e := NewEngine()
+		e.ClearForSearch()
+		e.verifyHeight = verifyHeight
+		e.verifyColor = verifyColor
+		line := NewPVLine(5)
+		score, _ := e.alphaBeta(position, 4, 1, -1, 0, 1, line, false, true, 0, EmptyMove)
+		return score
+	}
+	if score := search(0, Black); score < 0 {
+		t.Errorf("Expected the null move to fail high, got: %d", score)
+	}
+	if score := search(5, White); score < 0 {
+		t.Errorf("Expected the null move of the other side to fail high, got: %d", score)
+	}
+	if score := search(5, Black); score >= 0 {
+		t.Errorf("Expected the verified side not to try the null move, got: %d", score)
+	}
+}
+
+func TestQuiescenceSearchesQuietChecksAtTheFirstPly(t *testing.T) {
+	// Re8 is a quiet back-rank mate, captures alone cannot find it
+	game := FromFen("6k1/5ppp/8/8/8/8/8/4R1K1 w - - 0 1", true)
+	position := game.Position()
+	e := NewEngine()
+	e.ClearForSearch()
+	score := e.quiescence(position, -MAX_INT, MAX_INT, 0, Evaluate(position), 0, 1)
+	if score != CHECKMATE_EVAL {
+		t.Errorf("Expected the quiescence search to find the mate, got: %d", score)
+	}
+}
+
+func TestSearchParamsCanDisableIIRAndProbCut(t *testing.T) {
+	defaults := NewSearchParams()
+	noIIR := defaults
+	noIIR.IIRMinDepth = 127
+	noProbCut := defaults
+	noProbCut.ProbCutMinDepth = 127
+	for _, params := range []SearchParams{defaults, noIIR, noProbCut} {
+		game := FromFen("3N1k2/N7/1p2ppR1/1P6/P2pP3/3Pb3/2r4n/3K4 b - - 0 1", true)
+		e := NewEngine()
+		e.Params = params
+		e.Search(context.Background(), game.Position(), Limits{Depth: 7, Ply: 1})
+		expected := Move{C2, D2, NoType, Check}
+		mv := e.Move()
+		if mv != expected {
+			t.Errorf("Unexpected move was played with %v:%s\n", params, fmt.Sprintf("Expected: %s\nGot: %s\n", expected.ToString(), mv.ToString()))
+		}
+	}
+}
+
+func TestTimeManagerAllocation(t *testing.T) {
+	perMove := NewTimeManager(1000, true, 0, 0, 30)
+	if perMove.OptimumTime() != 970 || perMove.MaximumTime() != 970 {
+		t.Errorf("Expected the whole move time minus the overhead, got: %d and %d", perMove.OptimumTime(), perMove.MaximumTime())
+	}
+
+	suddenDeath := NewTimeManager(60_000, false, 0, 0, 30)
+	if suddenDeath.OptimumTime() >= suddenDeath.MaximumTime() || suddenDeath.MaximumTime() > 60_000*8/10 {
+		t.Errorf("Unexpected allocation: %d and %d", suddenDeath.OptimumTime(), suddenDeath.MaximumTime())
+	}
+
+	withIncrement := NewTimeManager(60_000, false, 1000, 0, 30)
+	if withIncrement.OptimumTime() <= suddenDeath.OptimumTime() {
+		t.Errorf("Expected the increment to give more time, got: %d", withIncrement.OptimumTime())
+	}
+
+	// The clock is almost out, yet we should neither flag nor think for nothing
+	scramble := NewTimeManager(20, false, 0, 0, 30)
+	if scramble.MaximumTime() < 1 || scramble.MaximumTime() > 20 {
+		t.Errorf("Unexpected allocation when the clock is almost out: %d", scramble.MaximumTime())
+	}
+}
+
+func TestTimeManagerScalesWithStability(t *testing.T) {
+	tm := NewTimeManager(60_000, false, 0, 0, 30)
+	elapsed := tm.OptimumTime()
+	stable := IterationStats{elapsed, 10, 4, 0, 0.9}
+	if !tm.ShouldStop(stable) {
+		t.Errorf("Expected to stop when the best move is stable")
+	}
+	unstable := IterationStats{elapsed, 10, 0, 50, 0.3}
+	if tm.ShouldStop(unstable) {
+		t.Errorf("Expected to think longer when the best move keeps changing")
+	}
+	// The next iteration would not finish before the maximum time
+	tooLong := IterationStats{10, tm.MaximumTime(), 0, 50, 0.3}
+	if !tm.ShouldStop(tooLong) {
+		t.Errorf("Expected not to start an iteration that cannot finish")
+	}
+}
+
+func TestSearchStopsWhenTheContextIsDone(t *testing.T) {
+	game := FromFen("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", true)
+	e := NewEngine()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	e.Search(ctx, game.Position(), Limits{Ply: 1})
+	if elapsed := time.Now().Sub(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the search to stop with the context, it took: %s", elapsed)
+	}
+	if e.Move() == EmptyMove {
+		t.Errorf("Expected a move to be found before the deadline")
+	}
+}
+
+func TestStopBeforeTheSearchStartsIsKept(t *testing.T) {
+	game := FromFen("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", true)
+	e := NewEngine()
+	e.Arm()
+	e.Stop() // between go and the search
+	result := e.Search(context.Background(), game.Position(), Limits{Depth: 8, Ply: 1})
+	if e.nodesVisited != 0 || result.BestMove == EmptyMove {
+		t.Errorf("Expected the search to stop at once with a legal move, got: %v after %d nodes", result.BestMove, e.nodesVisited)
+	}
+
+	// A stop when no search is armed is for the previous search
+	e.Stop()
+	e.Search(context.Background(), game.Position(), Limits{Depth: 3, Ply: 1})
+	if e.nodesVisited == 0 {
+		t.Errorf("Expected the search not to be stopped by a late stop")
+	}
+}
+
+func TestSearchRespectsTheNodeLimit(t *testing.T) {
+	game := FromFen("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", true)
+	e := NewEngine()
+	result := e.Search(context.Background(), game.Position(), Limits{Nodes: 5000, Ply: 1})
+	if result.Nodes > 5000+MAX_SEARCH_HEIGHT {
+		t.Errorf("Expected at most %d nodes, got: %d", 5000, result.Nodes)
+	}
+}
+
+type recordingListener struct {
+	iterations []SearchResult
+	rootMoves  int
+}
+
+func (l *recordingListener) OnIteration(info SearchResult) {
+	l.iterations = append(l.iterations, info)
+}
+
+func (l *recordingListener) OnRootMove(depth int8, move Move, moveNumber int) {
+	l.rootMoves += 1
+}
+
+func TestSearchReturnsTheResultAndNotifiesTheListener(t *testing.T) {
+	game := FromFen("3N1k2/N7/1p2ppR1/1P6/P2pP3/3Pbn2/3r4/4K3 w - - 2 2", true)
+	e := NewEngine()
+	listener := &recordingListener{}
+	e.SetInfoListener(listener)
+	result := e.Search(context.Background(), game.Position(), Limits{Depth: 7, Ply: 1})
+	if len(listener.iterations) == 0 || listener.rootMoves == 0 {
+		t.Errorf("Expected the listener to be notified, got %d iterations and %d root moves",
+			len(listener.iterations), listener.rootMoves)
+	}
+	if result.Depth != 7 || result.Nodes <= 0 || result.Bound != Exact {
+		t.Errorf("Unexpected result: depth %d, nodes %d, bound %d", result.Depth, result.Nodes, result.Bound)
+	}
+	if len(result.PV) < 2 || result.BestMove != result.PV[0] || result.PonderMove != result.PV[1] {
+		t.Errorf("Expected the best and ponder moves to start the pv, got: %v", result.PV)
+	}
+	if result.BestMove != e.Move() || result.Score != e.Score() {
+		t.Errorf("Expected the result to agree with the engine")
+	}
+	if result.MateIn != -1 { // Kf1 Rf2#
+		t.Errorf("Expected to be mated in 1, got: %d", result.MateIn)
+	}
+	if result.WDL.Loss != 1000 || result.Normalized != -CHECKMATE_EVAL {
+		t.Errorf("Expected a certain loss, got: %v and %d", result.WDL, result.Normalized)
+	}
+}
+
+// stoppingListener stops the search as soon as an aspiration window fails high
+// with a new best move
+type stoppingListener struct {
+	engine   *Engine
+	best     Move
+	failHigh *SearchResult
+}
+
+func (l *stoppingListener) OnIteration(info SearchResult) {
+	if info.Bound == Exact {
+		l.best = info.BestMove
+	} else if info.Bound == LowerBound && info.BestMove != l.best && l.failHigh == nil {
+		l.failHigh = &info
+		l.engine.Stop()
+	}
+}
+
+func (l *stoppingListener) OnRootMove(depth int8, move Move, moveNumber int) {}
+
+func TestSearchStoppedAfterAFailHighReturnsTheNewMove(t *testing.T) {
+	// Qc4+ mates, it is found when the aspiration window fails high
+	game := FromFen("5k2/6pp/p1qN4/1p1p4/3P4/2PKP2Q/PP3r2/3R4 b - - 0 1", true)
+	e := NewEngine()
+	listener := &stoppingListener{engine: e}
+	e.SetInfoListener(listener)
+	result := e.Search(context.Background(), game.Position(), Limits{Depth: 12, Ply: 1})
+	if listener.failHigh == nil {
+		t.Fatal("Expected the search to fail high with a new move")
+	}
+	expected := Move{C6, C4, NoType, Check}
+	if result.BestMove != expected || result.BestMove != e.Move() || result.BestMove != listener.failHigh.BestMove {
+		t.Errorf("Expected the fail-high move %s, got %s", expected.ToString(), result.BestMove.ToString())
+	}
+	if result.Bound != LowerBound || result.Depth != listener.failHigh.Depth || result.Score != listener.failHigh.Score {
+		t.Errorf("Expected the fail-high result, got: depth %d, score %d, bound %d", result.Depth, result.Score, result.Bound)
+	}
+}
+
+func TestContemptMakesTheRootSideDislikeDraws(t *testing.T) {
+	// Every white move that is not a mate reaches the fifty-move rule
+	game := FromFen("4k3/8/8/8/8/8/8/R3K3 w - - 99 80", true)
+	e := NewEngine()
+	result := e.Search(context.Background(), game.Position(), Limits{Depth: 3, Ply: 1, Contempt: 50})
+	if result.Score != -50 {
+		t.Errorf("Expected the draw to be scored -50 for white, got: %d", result.Score)
+	}
+	game = FromFen("4k3/8/8/8/8/8/8/R3K3 w - - 99 80", true)
+	result = e.Search(context.Background(), game.Position(), Limits{Depth: 3, Ply: 1, Contempt: 48, ScaleContempt: true})
+	if expected := -48 * (MAX_PHASE + 2) / (2 * MAX_PHASE); result.Score != expected {
+		t.Errorf("Expected the scaled draw to be scored %d for white, got: %d", expected, result.Score)
+	}
+}
+
+func TestSkillFromElo(t *testing.T) {
+	if level := SkillFromElo(MIN_ELO - 100).Level; level != 0 {
+		t.Errorf("Expected the lowest Elo to be level 0, got: %d", level)
+	}
+	if skill := SkillFromElo(MAX_ELO); skill.Level != MAX_SKILL_LEVEL-1 || !skill.IsLimited() {
+		t.Errorf("Expected the highest Elo to be a limited level %d, got: %d", MAX_SKILL_LEVEL-1, skill.Level)
+	}
+	if NewSkill(MAX_SKILL_LEVEL + 5).IsLimited() {
+		t.Errorf("Expected the full strength not to be limited")
+	}
+}
+
+func TestSkillPicksAmongTheBestMoves(t *testing.T) {
+	candidates := []skillCandidate{
+		{Move{E2, E4, NoType, 0}, 100, nil},
+		{Move{D2, D4, NoType, 0}, 90, nil},
+		{Move{G1, F3, NoType, 0}, -500, nil},
+		{Move{F2, F3, NoType, 0}, -CHECKMATE_EVAL, nil},
+	}
+	random := rand.New(rand.NewSource(1))
+	picks := make(map[Move]int)
+	for i := 0; i < 1000; i++ {
+		picks[NewSkill(0).pick(candidates, random).move] += 1
+	}
+	if picks[candidates[0].move] == 0 || picks[candidates[1].move] == 0 {
+		t.Errorf("Expected both good moves to be played, got: %v", picks)
+	}
+	if picks[candidates[2].move] != 0 || picks[candidates[3].move] != 0 {
+		t.Errorf("Expected the losing moves never to be played, got: %v", picks)
+	}
+
+	candidates[0].score = CHECKMATE_EVAL
+	if move := NewSkill(0).pick(candidates, random).move; move != candidates[0].move {
+		t.Errorf("Expected the mate to be played, got: %s", move.ToString())
+	}
+}
+
+func TestSkillLimitsTheSearch(t *testing.T) {
+	game := FromFen("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", true)
+	e := NewEngine()
+	e.Skill = NewSkill(0)
+	result := e.Search(context.Background(), game.Position(), Limits{Ply: 1})
+	if result.Depth != e.Skill.MaxDepth() {
+		t.Errorf("Expected the depth to be capped at %d, got: %d", e.Skill.MaxDepth(), result.Depth)
+	}
+	if result.Nodes > e.Skill.MaxNodes() {
+		t.Errorf("Expected at most %d nodes, got: %d", e.Skill.MaxNodes(), result.Nodes)
+	}
+	if _, ok := game.Position().ValidateMove(result.BestMove); !ok {
+		t.Errorf("Expected a legal move, got: %s", result.BestMove.ToString())
+	}
+}
+
+func TestFitSkillElosIsIncreasingAndAnchoredAtLevelZero(t *testing.T) {
+	var pairs []GauntletPair
+	for level := 1; level < MAX_SKILL_LEVEL; level++ {
+		points := 75.0 - float64(level) // From 74% down to 56%, noisy around the trend
+		if level%2 == 0 {
+			points -= 4
+		}
+		pairs = append(pairs, GauntletPair{level, 100, points, points})
+	}
+	elos := FitSkillElos(pairs)
+	if elos[0] != 0 {
+		t.Errorf("Expected level 0 to be the anchor, got: %f", elos[0])
+	}
+	for level := 1; level < MAX_SKILL_LEVEL; level++ {
+		if elos[level] <= elos[level-1] {
+			t.Errorf("Expected level %d to be stronger than level %d, got: %v", level, level-1, elos)
+		}
+	}
+	if elo := (GauntletPair{1, 100, 75, 75}).Elo(); elo < 190 || elo > 192 {
+		t.Errorf("Expected a 75%% score to be about 191 Elo, got: %f", elo)
+	}
+}
@@ -0,0 +1,176 @@
+package search
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+
+	. "github.com/amanjpro/zahak/cache"
+	. "github.com/amanjpro/zahak/engine"
+	. "github.com/amanjpro/zahak/evaluation"
+)
+
+// Skill levels go from 0 to MAX_SKILL_LEVEL, the latter is the full strength
+const MAX_SKILL_LEVEL = 20
+
+// The range of UCI_Elo, skill level 0 plays at about MIN_ELO and the level below
+// the full strength at about MAX_ELO
+const MIN_ELO = 800
+const MAX_ELO = 2400
+
+// The number of best moves a weakened engine chooses from
+const SKILL_CANDIDATES = 4
+
+// Neither the randomized choice nor the deliberate inaccuracies lose more than this
+const BLUNDER_MARGIN = int32(300)
+
+// The most the randomized choice can add to a candidate, about a pawn
+const SKILL_MAX_DELTA = int32(100)
+
+// Skill weakens the engine: it caps the depth and the nodes of the search, scores all
+// the root moves and picks one of the best ones randomly, weighted by their scores
+type Skill struct {
+	Level int
+}
+
+func NewSkill(level int) Skill {
+	if level < 0 {
+		level = 0
+	} else if level > MAX_SKILL_LEVEL {
+		level = MAX_SKILL_LEVEL
+	}
+	return Skill{level}
+}
+
+// SkillFromElo maps the Elo linearly to the levels below the full strength
+func SkillFromElo(elo int) Skill {
+	if elo < MIN_ELO {
+		elo = MIN_ELO
+	} else if elo > MAX_ELO {
+		elo = MAX_ELO
+	}
+	return NewSkill((elo - MIN_ELO) * (MAX_SKILL_LEVEL - 1) / (MAX_ELO - MIN_ELO))
+}
+
+func (s Skill) IsLimited() bool {
+	return s.Level < MAX_SKILL_LEVEL
+}
+
+// Every level gets one more ply, and about 41% more nodes than the level below it,
+// the depth is what limits the lowest levels and the nodes the others
+func (s Skill) MaxDepth() int8 {
+	return int8(1 + s.Level)
+}
+
+func (s Skill) MaxNodes() int64 {
+	return int64(1000 * math.Pow(2, float64(s.Level)/2))
+}
+
+// The weaker the engine, the more it ignores the differences between the candidates
+func (s Skill) weakness() int64 {
+	return int64(120 - 2*s.Level)
+}
+
+// The chance to play a random move, that does not lose too much
+func (s Skill) blunderChance() float64 {
+	return float64(MAX_SKILL_LEVEL-s.Level) / 200
+}
+
+type skillCandidate struct {
+	move  Move
+	score int32
+	line  *PVLine
+}
+
+// pick chooses a move among the candidates, that are sorted from the best to the worst
+func (s Skill) pick(candidates []skillCandidate, random *rand.Rand) skillCandidate {
+	best := candidates[0]
+	if best.score == CHECKMATE_EVAL {
+		return best
+	}
+
+	if random.Float64() < s.blunderChance() {
+		playable := 1
+		for playable < len(candidates) && candidates[playable].score >= best.score-BLUNDER_MARGIN {
+			playable++
+		}
+		return candidates[random.Intn(playable)]
+	}
+
+	top := candidates
+	if len(top) > SKILL_CANDIDATES {
+		top = top[:SKILL_CANDIDATES]
+	}
+	delta := int64(min32(best.score-top[len(top)-1].score, SKILL_MAX_DELTA))
+	weakness := s.weakness()
+	chosen := best
+	maxScore := int64(-MAX_INT)
+	for _, candidate := range top {
+		if candidate.score < best.score-BLUNDER_MARGIN {
+			continue
+		}
+		// The worse the candidate, the bigger the push it gets from the weakness,
+		// the randomness decides how close it gets to the best move
+		push := (weakness*int64(best.score-candidate.score) + delta*random.Int63n(weakness)) / 128
+		if score := int64(candidate.score) + push; score >= maxScore {
+			maxScore = score
+			chosen = candidate
+		}
+	}
+	return chosen
+}
+
+// skillSearch scores every root move with a full window, deepening until the limits
+// are reached, and then lets the skill pick the move to play
+func (e *Engine) skillSearch(position *Position, depth int8, ply uint16) {
+	e.move = EmptyMove
+	e.score = -MAX_INT
+	moves := position.LegalMoves()
+	if len(moves) == 0 {
+		return
+	}
+
+	var candidates []skillCandidate
+	for iterationDepth := int8(1); iterationDepth <= depth && !e.ShouldStop(); iterationDepth++ {
+		scored := make([]skillCandidate, 0, len(moves))
+		for i, move := range moves {
+			e.notifyRootMove(iterationDepth, move, i+1)
+			line := NewPVLine(iterationDepth + 1)
+			e.pushMove(0, move, position.Board.PieceAt(move.Source))
+			cp, ep, tg, hc := position.MakeMove(move)
+			score, ok := e.alphaBeta(position, iterationDepth-1, 1, -MAX_INT, MAX_INT, ply, line, true, true, 0, EmptyMove)
+			position.UnMakeMove(move, tg, ep, cp, hc)
+			if !ok {
+				break
+			}
+			pv := NewPVLine(iterationDepth + 1)
+			pv.AddFirst(move)
+			pv.ReplaceLine(line)
+			scored = append(scored, skillCandidate{move, -score, pv})
+		}
+		// An unfinished iteration is only used when there is nothing better
+		if len(scored) < len(moves) && candidates != nil || len(scored) == 0 {
+			break
+		}
+		sort.SliceStable(scored, func(i, j int) bool {
+			return scored[i].score > scored[j].score
+		})
+		candidates = scored
+		for i, candidate := range candidates { // The best moves are searched first in the next iteration
+			moves[i] = candidate.move
+		}
+		e.pv = candidates[0].line
+		e.score = candidates[0].score
+		e.move = candidates[0].move
+		e.depth = iterationDepth
+		e.notifyIteration(position, iterationDepth, e.pv, e.score, Exact)
+	}
+
+	if candidates == nil {
+		return
+	}
+	chosen := e.Skill.pick(candidates, e.random)
+	e.pv = chosen.line
+	e.score = chosen.score
+	e.move = chosen.move
+}
@@ -1,55 +1,126 @@
 package search
 
-import (
-	"time"
-
-	. "github.com/amanjpro/zahak/engine"
-)
-
-func (e *Engine) InitiateTimer(game *Game, availableTimeInMillis int, isPerMove bool,
-	increment int, movesToTimeControl int) {
-	maximumTimeToThink := 0
-	numberOfMovesOutOfBook := int(game.MoveClock()) / 2 // FIXME: Yup, fix it
-	nMoves := min(numberOfMovesOutOfBook, 10)
-	factor := 2 - nMoves/10
+const DEFAULT_MOVE_OVERHEAD = int64(30)
+const DEFAULT_MOVES_TO_GO = 40
+const MAX_MOVES_TO_GO = 50
+const MAX_TIME_FACTOR = int64(5)
+
+// The number of times the previous iteration took, that the next iteration is expected to take
+const ITERATION_GROWTH = int64(2)
+
+// TimeManager decides how long to think on a move. The optimum time is what we
+// aim to spend, and is scaled at the end of every iteration depending on how
+// stable the search is. The maximum time is never exceeded
+type TimeManager struct {
+	optimumTime int64
+	maximumTime int64
+}
+
+// NewTimeManager allocates the time for the next move, all times are in milliseconds.
+// The move overhead is the time that is lost on every move, say for communication
+func NewTimeManager(availableTimeInMillis int64, isPerMove bool, increment int64, movesToGo int, moveOverhead int64) *TimeManager {
 	if isPerMove {
-		maximumTimeToThink = availableTimeInMillis - 100 + increment
-	} else {
-		if movesToTimeControl == 0 {
-			mlh := max(60-int(game.MoveClock()), 20) // We assume that there are 60 more moves to go
-			timeInMinute := time.Duration(availableTimeInMillis).Minutes()
-			if timeInMinute <= 15 {
-				mlh = max(50-int(game.MoveClock()), 20) // We assume that there are 60 more moves to go
-			}
-			if game.Position().IsEndGame() {
-				movesToTimeControl = abs(mlh)
-			} else {
-				movesToTimeControl = abs(mlh + 10) // add 10 more moves in the early stage
-			}
-		}
+		maximum := max64(availableTimeInMillis-moveOverhead, 1)
+		return &TimeManager{maximum, maximum}
+	}
+	if movesToGo <= 0 {
+		movesToGo = DEFAULT_MOVES_TO_GO
+	}
+	mtg := int64(min(movesToGo, MAX_MOVES_TO_GO))
+
+	// The time we have for the rest of the moves to go, counting the increments
+	// we are going to receive, and the overhead we are going to lose
+	timeLeft := max64(availableTimeInMillis+increment*(mtg-1)-moveOverhead*(mtg+2), 1)
+	usable := max64(availableTimeInMillis-moveOverhead, 1)
+
+	optimum := min64(timeLeft/mtg, usable/2)
+	maximum := min64(optimum*MAX_TIME_FACTOR, usable*8/10)
+	return &TimeManager{max64(optimum, 1), max64(maximum, 1)}
+}
+
+func (tm *TimeManager) OptimumTime() int64 {
+	return tm.optimumTime
+}
+
+func (tm *TimeManager) MaximumTime() int64 {
+	return tm.maximumTime
+}
+
+// IterationStats is what the time manager needs to know about the finished iterations
+type IterationStats struct {
+	Elapsed               int64   // The time since the search started
+	LastIterationTime     int64   // The time the last iteration took
+	BestMoveStability     int     // The number of iterations the best move did not change
+	ScoreDrop             int32   // How much the score dropped in the last iteration, negative if it improved
+	BestMoveNodesFraction float64 // The fraction of the nodes of the last iteration spent on the best move
+}
+
+// ShouldStop decides whether to start another iteration. The optimum time is extended
+// when the best move keeps changing, when the score drops and when the best move is not
+// clearly better than the alternatives, and shortened otherwise. A new iteration that
+// is not expected to finish in time is not started at all
+func (tm *TimeManager) ShouldStop(stats IterationStats) bool {
+	stability := []float64{1.5, 1.25, 1.05, 0.9, 0.8}
+	stabilityFactor := stability[min(stats.BestMoveStability, len(stability)-1)]
+
+	scoreFactor := 1.0
+	if stats.ScoreDrop > 0 {
+		scoreFactor += float64(min32(stats.ScoreDrop, 100)) / 200
+	}
+
+	nodesFactor := (1.5 - stats.BestMoveNodesFraction) * 1.4
+
+	optimum := int64(float64(tm.optimumTime) * stabilityFactor * scoreFactor * nodesFactor)
+	optimum = min64(optimum, tm.maximumTime)
+	if stats.Elapsed >= optimum {
+		return true
+	}
+	return stats.Elapsed+stats.LastIterationTime*ITERATION_GROWTH > tm.maximumTime
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
 
-		target := availableTimeInMillis / movesToTimeControl
-		maximumTimeToThink = factor * target
+func max64(a int64, b int64) int64 {
+	if a > b {
+		return a
 	}
+	return b
+}
 
-	e.ThinkTime = int64(maximumTimeToThink)
+func min64(a int64, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
 }
 
-func abs(num int) int {
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func abs32(num int32) int32 {
 	if num < 0 {
 		return -num
 	}
 	return num
 }
 
-func max(a int, b int) int {
+func max32(a int32, b int32) int32 {
 	if a > b {
 		return a
 	}
 	return b
 }
 
-func min(a int, b int) int {
+func min32(a int32, b int32) int32 {
 	if a < b {
 		return a
 	}
@@ -0,0 +1,137 @@
+package tuning
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	. "github.com/amanjpro/zahak/engine"
+	. "github.com/amanjpro/zahak/evaluation"
+)
+
+// The captures that resolve a position are searched this deep at most
+const MAX_RESOLVE_HEIGHT = 16
+
+// entry is a quiet position and the result of its game, from white's point of view.
+// Only the board and the tags are kept, full positions are too big to hold many of them
+type entry struct {
+	board  Bitboard
+	tag    PositionTag
+	result float64
+}
+
+func (e *entry) position() *Position {
+	return &Position{Board: e.board, Tag: e.tag}
+}
+
+type Dataset struct {
+	entries []entry
+}
+
+func (d *Dataset) Len() int {
+	return len(d.entries)
+}
+
+// ReadDataset reads one position per line, as an EPD or a FEN, followed by the result
+// of the game: c9 "1-0", [1.0], [0.5] and a plain 1/2-1/2 are all understood.
+// Positions in check are skipped, and the others are resolved with the captures that
+// the quiescence search would play, so that the evaluation is used on quiet positions
+func ReadDataset(reader io.Reader) (*Dataset, error) {
+	dataset := &Dataset{}
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fen, result, err := parseLine(line)
+		if err != nil {
+			return dataset, fmt.Errorf("line %d: %s", lineNumber, err)
+		}
+		position, err := parseFen(fen)
+		if err != nil {
+			return dataset, fmt.Errorf("line %d: %s", lineNumber, err)
+		}
+		if position.IsInCheck() {
+			continue
+		}
+		resolve(position)
+		dataset.entries = append(dataset.entries, entry{position.Board, position.Tag, result})
+	}
+	return dataset, scanner.Err()
+}
+
+// parseLine splits the line into the FEN of the position and the result of the game
+func parseLine(line string) (string, float64, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return "", 0, fmt.Errorf("%s has no position and result", line)
+	}
+	// The move counters do not matter to the evaluation, and EPDs do not have them
+	fen := strings.Join(fields[:4], " ") + " 0 1"
+	for _, field := range fields[4:] {
+		token := strings.Trim(field, `";`)
+		switch token {
+		case "1-0":
+			return fen, 1, nil
+		case "0-1":
+			return fen, 0, nil
+		case "1/2-1/2":
+			return fen, 0.5, nil
+		}
+		if strings.HasPrefix(token, "[") && strings.HasSuffix(token, "]") {
+			result, err := strconv.ParseFloat(strings.Trim(token, "[]"), 64)
+			if err != nil || result < 0 || result > 1 {
+				return "", 0, fmt.Errorf("%s is not a valid result", token)
+			}
+			return fen, result, nil
+		}
+	}
+	return "", 0, fmt.Errorf("%s has no result", line)
+}
+
+func parseFen(fen string) (position *Position, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return PositionFromFen(fen), nil
+}
+
+// resolve plays the captures of the principal variation of a captures only search
+func resolve(position *Position) {
+	_, pv := principalCaptures(position, -MAX_INT, MAX_INT, 0)
+	for _, move := range pv {
+		position.MakeMove(move)
+	}
+}
+
+func principalCaptures(position *Position, alpha int32, beta int32, height int) (int32, []Move) {
+	standPat := Evaluate(position)
+	if standPat >= beta || height >= MAX_RESOLVE_HEIGHT {
+		return standPat, nil
+	}
+	if standPat > alpha {
+		alpha = standPat
+	}
+	var pv []Move
+	for _, move := range position.CaptureMoves() {
+		cp, ep, tg, hc := position.MakeMove(move)
+		score, line := principalCaptures(position, -beta, -alpha, height+1)
+		position.UnMakeMove(move, tg, ep, cp, hc)
+		score = -score
+		if score >= beta {
+			return score, nil
+		}
+		if score > alpha {
+			alpha = score
+			pv = append([]Move{move}, line...)
+		}
+	}
+	return alpha, pv
+}
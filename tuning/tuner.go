@@ -0,0 +1,125 @@
+package tuning
+
+import (
+	"math"
+	"sync"
+
+	. "github.com/amanjpro/zahak/engine"
+	. "github.com/amanjpro/zahak/evaluation"
+)
+
+// Tuner fits the evaluation parameters to the results of the games of a dataset, by
+// minimizing the mean squared error between the results and the win probabilities
+// predicted by the evaluation, 1 / (1 + 10^(-K * score / 400))
+type Tuner struct {
+	dataset *Dataset
+	threads int
+	K       float64
+}
+
+func NewTuner(dataset *Dataset, threads int) *Tuner {
+	if threads < 1 {
+		threads = 1
+	}
+	return &Tuner{dataset, threads, 1}
+}
+
+func sigmoid(k float64, score int32) float64 {
+	return 1 / (1 + math.Pow(10, -k*float64(score)/400))
+}
+
+// Error is the mean squared error of the evaluation with the parameters, computed
+// by splitting the dataset between the threads
+func (t *Tuner) Error(params *EvalParams, k float64) float64 {
+	entries := t.dataset.entries
+	if len(entries) == 0 {
+		return 0
+	}
+	sums := make([]float64, t.threads)
+	chunk := (len(entries) + t.threads - 1) / t.threads
+	var wg sync.WaitGroup
+	for thread := 0; thread < t.threads; thread++ {
+		start := thread * chunk
+		end := start + chunk
+		if end > len(entries) {
+			end = len(entries)
+		}
+		if start >= end {
+			break
+		}
+		wg.Add(1)
+		go func(thread int, entries []entry) {
+			defer wg.Done()
+			sum := 0.0
+			for i := range entries {
+				position := entries[i].position()
+				score := EvaluateWith(position, params)
+				if position.Turn() == Black {
+					score = -score
+				}
+				diff := entries[i].result - sigmoid(k, score)
+				sum += diff * diff
+			}
+			sums[thread] = sum
+		}(thread, entries[start:end])
+	}
+	wg.Wait()
+
+	sum := 0.0
+	for _, s := range sums {
+		sum += s
+	}
+	return sum / float64(len(entries))
+}
+
+// FitK finds the scaling constant that minimizes the error of the parameters,
+// scanning ever smaller ranges around the best constant so far
+func (t *Tuner) FitK(params *EvalParams) float64 {
+	start, end, step := 0.0, 3.0, 0.1
+	best := t.K
+	bestError := t.Error(params, best)
+	for i := 0; i < 4; i++ {
+		for k := start; k <= end; k += step {
+			if err := t.Error(params, k); err < bestError {
+				best = k
+				bestError = err
+			}
+		}
+		start = math.Max(0, best-step)
+		end = best + step
+		step /= 10
+	}
+	t.K = best
+	return best
+}
+
+// Tune improves the parameters with a local search, every pass nudges every weight
+// by one in both directions and keeps the changes that reduce the error. It stops when
+// a pass changes nothing or after the given number of passes, when it is positive.
+// The callback is called after every pass that improves the parameters
+func (t *Tuner) Tune(initial EvalParams, passes int, onPass func(pass int, params EvalParams, err float64)) EvalParams {
+	params := initial
+	weights := params.Weights()
+	bestError := t.Error(&params, t.K)
+	for pass := 1; passes <= 0 || pass <= passes; pass++ {
+		improved := false
+		for _, weight := range weights {
+			for _, delta := range []int32{1, -1} {
+				*weight += delta
+				if err := t.Error(&params, t.K); err < bestError {
+					bestError = err
+					improved = true
+					break
+				}
+				*weight -= delta
+			}
+		}
+		if !improved {
+			break
+		}
+		if onPass != nil {
+			onPass(pass, params, bestError)
+		}
+	}
+	return params
+}
@@ -0,0 +1,83 @@
+package tuning
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/amanjpro/zahak/engine"
+	. "github.com/amanjpro/zahak/evaluation"
+)
+
+const dataset = `rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - c9 "1/2-1/2";
+4k3/8/8/8/8/8/8/R3K3 w - - c9 "1-0";
+4k3/8/8/8/8/8/4q3/4K3 w - - 0 1 [0.0]
+r3k3/8/8/8/8/8/8/4K3 b - - 0 1 0-1
+# A comment
+7k/8/8/3p4/4Q3/8/8/4K3 w - - 0 1 [1.0]
+4k3/4p3/8/8/8/8/4P3/4K3 w - - c9 "1/2-1/2";
+`
+
+func TestParseLine(t *testing.T) {
+	fen, result, err := parseLine(`4k3/8/8/8/8/8/8/R3K3 w - - c9 "1-0";`)
+	if err != nil || fen != "4k3/8/8/8/8/8/8/R3K3 w - - 0 1" || result != 1 {
+		t.Errorf("Unexpected parse: %s %f %v", fen, result, err)
+	}
+	_, result, err = parseLine("4k3/8/8/8/8/8/8/R3K3 w - - 3 40 [0.5]")
+	if err != nil || result != 0.5 {
+		t.Errorf("Unexpected parse: %f %v", result, err)
+	}
+	if _, _, err = parseLine("4k3/8/8/8/8/8/8/R3K3 w - - 3 40"); err == nil {
+		t.Error("A line without a result should not be accepted")
+	}
+	if _, _, err = parseLine("4k3/8/8/8/8/8/8/R3K3 w - - [1.5]"); err == nil {
+		t.Error("A result out of range should not be accepted")
+	}
+}
+
+func TestReadDataset(t *testing.T) {
+	data, err := ReadDataset(strings.NewReader(dataset))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The position in check is skipped
+	if data.Len() != 5 {
+		t.Errorf("Expected 5 positions, got %d", data.Len())
+	}
+
+	// The hanging pawn is captured before the position is evaluated
+	resolved := data.entries[3]
+	expected := PositionFromFen("7k/8/8/3Q4/8/8/8/4K3 b - - 0 1")
+	if resolved.board != expected.Board || resolved.tag != expected.Tag || resolved.result != 1 {
+		t.Errorf("Unexpected resolved position %s", resolved.position().Fen())
+	}
+
+	if _, err = ReadDataset(strings.NewReader("4k3/8/8/8/8/8/8/R3K3 w - z9 [1.0]")); err == nil {
+		t.Error("An invalid FEN should not be accepted")
+	}
+}
+
+func TestTuneReducesTheError(t *testing.T) {
+	data, err := ReadDataset(strings.NewReader(dataset))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tuner := NewTuner(data, 3)
+	params := DefaultEvalParams()
+	k := tuner.FitK(&params)
+	if k <= 0 {
+		t.Errorf("Expected a positive K, got %f", k)
+	}
+	initialError := tuner.Error(&params, k)
+
+	passes := 0
+	tuned := tuner.Tune(params, 2, func(pass int, params EvalParams, err float64) {
+		passes = pass
+	})
+	tunedError := tuner.Error(&tuned, k)
+	if passes == 0 || tunedError >= initialError {
+		t.Errorf("Expected the error to go down from %f, got %f after %d passes", initialError, tunedError, passes)
+	}
+	if params != DefaultEvalParams() {
+		t.Error("The initial parameters should not change")
+	}
+}
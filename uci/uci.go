@@ -2,33 +2,108 @@ package uci
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	. "github.com/amanjpro/zahak/book"
 	. "github.com/amanjpro/zahak/cache"
 	. "github.com/amanjpro/zahak/engine"
+	. "github.com/amanjpro/zahak/evaluation"
 	. "github.com/amanjpro/zahak/search"
 )
 
 const startFen = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
 
 type UCI struct {
-	engine   *Engine
-	thinking bool
+	engine           *Engine
+	thinking         bool
+	ownBook          bool
+	book             *Book
+	bookDepth        int
+	bestBookMove     bool
+	moveOverhead     int
+	contempt         int32
+	scaleContempt    bool
+	analysisContempt string // Off, White, Black or Both
+	analyseMode      bool
+	limitStrength    bool
+	elo              int
+	skillLevel       int
+	showWDL          bool
+	useNetwork       bool
+	network          *Network
 }
 
 func NewUCI() *UCI {
-	return &UCI{
+	uci := &UCI{
 		NewEngine(),
 		false,
+		false,
+		nil,
+		20,
+		false,
+		int(DEFAULT_MOVE_OVERHEAD),
+		0,
+		true,
+		"Off",
+		false,
+		false,
+		MAX_ELO,
+		MAX_SKILL_LEVEL,
+		false,
+		false,
+		nil,
+	}
+	uci.engine.SetInfoListener(infoPrinter{uci})
+	return uci
+}
+
+// infoPrinter reports the progress of the search to the GUI
+type infoPrinter struct {
+	uci *UCI
+}
+
+func (printer infoPrinter) OnIteration(info SearchResult) {
+	score := fmt.Sprintf("cp %d", info.Normalized)
+	if info.MateIn != 0 {
+		score = fmt.Sprintf("mate %d", info.MateIn)
+	}
+	if info.Bound == LowerBound {
+		score += " lowerbound"
+	} else if info.Bound == UpperBound {
+		score += " upperbound"
+	}
+	if printer.uci.showWDL {
+		score += fmt.Sprintf(" wdl %d %d %d", info.WDL.Win, info.WDL.Draw, info.WDL.Loss)
+	}
+	pv := make([]string, len(info.PV))
+	for i, move := range info.PV {
+		pv[i] = move.ToString()
+	}
+	fmt.Printf("info depth %d seldepth %d score %s nodes %d nps %d hashfull %d time %d pv %s\n\n",
+		info.Depth, info.SelDepth, score, info.Nodes, nps(info.Nodes, info.Time),
+		TranspositionTable.Consumed(), info.Time.Milliseconds(), strings.Join(pv, " "))
+}
+
+func (infoPrinter) OnRootMove(depth int8, move Move, moveNumber int) {
+	fmt.Printf("info depth %d currmove %s currmovenumber %d\n\n", depth, move.ToString(), moveNumber)
+}
+
+func nps(nodes int64, duration time.Duration) int64 {
+	if duration <= 0 {
+		return 0
 	}
+	return int64(float64(nodes) / duration.Seconds())
 }
 
 func (uci *UCI) Start() {
 	var game Game
-	var depth = int8(100)
+	var depth = int8(0)
 	reader := bufio.NewReader(os.Stdin)
 	for true {
 		cmd, err := reader.ReadString('\n')
@@ -39,20 +114,129 @@ func (uci *UCI) Start() {
 			case "uci\n":
 				fmt.Print("id name Zahak\n\n")
 				fmt.Print("id author Amanj\n\n")
+				fmt.Print("option name Threads type spin default 1 min 1 max 256\n")
+				fmt.Print("option name OwnBook type check default false\n")
+				fmt.Print("option name BookFile type string default <empty>\n")
+				fmt.Print("option name BookDepth type spin default 20 min 1 max 100\n")
+				fmt.Print("option name Best Book Move type check default false\n")
+				fmt.Printf("option name Move Overhead type spin default %d min 0 max 5000\n", DEFAULT_MOVE_OVERHEAD)
+				fmt.Print("option name Contempt type spin default 0 min -100 max 100\n")
+				fmt.Print("option name Contempt Scaling type check default true\n")
+				fmt.Print("option name Analysis Contempt type combo default Off var Off var White var Black var Both\n")
+				fmt.Print("option name UCI_AnalyseMode type check default false\n")
+				fmt.Printf("option name Skill Level type spin default %d min 0 max %d\n", MAX_SKILL_LEVEL, MAX_SKILL_LEVEL)
+				fmt.Print("option name UCI_LimitStrength type check default false\n")
+				fmt.Print("option name UCI_ShowWDL type check default false\n")
+				fmt.Print("option name EvalFile type string default <empty>\n")
+				fmt.Print("option name Use NNUE type check default false\n")
+				fmt.Print("option name NNUE File type string default <empty>\n")
+				fmt.Printf("option name UCI_Elo type spin default %d min %d max %d\n", MAX_ELO, MIN_ELO, MAX_ELO)
 				fmt.Print("uciok\n\n")
 			case "isready\n":
 				fmt.Print("readyok\n\n")
 			case "ucinewgame\n":
 				game = FromFen(startFen, true)
+				uci.engine.ClearHistory()
 			case "stop\n":
-				uci.engine.StopSearchFlag = true
+				uci.engine.Stop()
+			case "eval\n":
+				fmt.Print(EvaluateTrace(game.Position()))
+				if CurrentNetwork() != nil {
+					fmt.Printf("NNUE: %d (side to move)\n", game.Position().NetworkEvaluate())
+				}
+			case "eval json\n":
+				trace, _ := json.Marshal(EvaluateTrace(game.Position()))
+				fmt.Printf("%s\n", trace)
 			default:
 				if strings.HasPrefix(cmd, "setoption name Hash value") {
 					options := strings.Fields(cmd)
 					mg := options[len(options)-1]
 					hashSize, _ := strconv.Atoi(mg)
 					NewCache(uint32(hashSize))
+				} else if strings.HasPrefix(cmd, "setoption name Threads value") {
+					options := strings.Fields(cmd)
+					threads, _ := strconv.Atoi(options[len(options)-1])
+					uci.engine.SetThreads(threads)
+				} else if strings.HasPrefix(cmd, "setoption name OwnBook value") {
+					options := strings.Fields(cmd)
+					uci.ownBook = options[len(options)-1] == "true"
+				} else if strings.HasPrefix(cmd, "setoption name BookFile value") {
+					path := strings.TrimSpace(strings.TrimPrefix(cmd, "setoption name BookFile value"))
+					book, err := LoadBook(path)
+					if err != nil {
+						fmt.Printf("info string could not load the opening book: %s\n", err)
+						uci.book = nil
+					} else {
+						fmt.Printf("info string loaded %d book entries from %s\n", book.Size(), path)
+						uci.book = book
+					}
+				} else if strings.HasPrefix(cmd, "setoption name EvalFile value") {
+					path := strings.TrimSpace(strings.TrimPrefix(cmd, "setoption name EvalFile value"))
+					if path == "" || path == "<empty>" {
+						SetEvalParams(DefaultEvalParams())
+					} else if params, err := LoadEvalParams(path); err != nil {
+						fmt.Printf("info string could not load the evaluation parameters: %s\n", err)
+					} else {
+						fmt.Printf("info string loaded the evaluation parameters from %s\n", path)
+						SetEvalParams(params)
+					}
+				} else if strings.HasPrefix(cmd, "setoption name Use NNUE value") {
+					options := strings.Fields(cmd)
+					uci.useNetwork = options[len(options)-1] == "true"
+					uci.updateNetwork()
+				} else if strings.HasPrefix(cmd, "setoption name NNUE File value") {
+					path := strings.TrimSpace(strings.TrimPrefix(cmd, "setoption name NNUE File value"))
+					uci.network = nil
+					if path != "" && path != "<empty>" {
+						if network, err := LoadNetwork(path); err != nil {
+							fmt.Printf("info string could not load the network: %s\n", err)
+						} else {
+							fmt.Printf("info string loaded a network with %d hidden neurons from %s\n", network.Hidden, path)
+							uci.network = network
+						}
+					}
+					uci.updateNetwork()
+				} else if strings.HasPrefix(cmd, "setoption name BookDepth value") {
+					options := strings.Fields(cmd)
+					depth, _ := strconv.Atoi(options[len(options)-1])
+					uci.bookDepth = depth
+				} else if strings.HasPrefix(cmd, "setoption name Best Book Move value") {
+					options := strings.Fields(cmd)
+					uci.bestBookMove = options[len(options)-1] == "true"
+				} else if strings.HasPrefix(cmd, "setoption name Move Overhead value") {
+					options := strings.Fields(cmd)
+					overhead, _ := strconv.Atoi(options[len(options)-1])
+					uci.moveOverhead = overhead
+				} else if strings.HasPrefix(cmd, "setoption name Contempt value") {
+					options := strings.Fields(cmd)
+					contempt, _ := strconv.Atoi(options[len(options)-1])
+					uci.contempt = int32(contempt)
+				} else if strings.HasPrefix(cmd, "setoption name Contempt Scaling value") {
+					options := strings.Fields(cmd)
+					uci.scaleContempt = options[len(options)-1] == "true"
+				} else if strings.HasPrefix(cmd, "setoption name Analysis Contempt value") {
+					options := strings.Fields(cmd)
+					uci.analysisContempt = options[len(options)-1]
+				} else if strings.HasPrefix(cmd, "setoption name UCI_AnalyseMode value") {
+					options := strings.Fields(cmd)
+					uci.analyseMode = options[len(options)-1] == "true"
+				} else if strings.HasPrefix(cmd, "setoption name Skill Level value") {
+					options := strings.Fields(cmd)
+					uci.skillLevel, _ = strconv.Atoi(options[len(options)-1])
+					uci.updateSkill()
+				} else if strings.HasPrefix(cmd, "setoption name UCI_LimitStrength value") {
+					options := strings.Fields(cmd)
+					uci.limitStrength = options[len(options)-1] == "true"
+					uci.updateSkill()
+				} else if strings.HasPrefix(cmd, "setoption name UCI_ShowWDL value") {
+					options := strings.Fields(cmd)
+					uci.showWDL = options[len(options)-1] == "true"
+				} else if strings.HasPrefix(cmd, "setoption name UCI_Elo value") {
+					options := strings.Fields(cmd)
+					uci.elo, _ = strconv.Atoi(options[len(options)-1])
+					uci.updateSkill()
 				} else if strings.HasPrefix(cmd, "go") {
+					uci.engine.Arm() // A stop that comes before the search starts is not lost
 					go uci.findMove(game, depth, game.MoveClock(), cmd)
 				} else if strings.HasPrefix(cmd, "position startpos moves") {
 					moves := strings.Fields(cmd)[3:]
@@ -84,59 +268,119 @@ func (uci *UCI) Start() {
 }
 
 func (uci *UCI) findMove(game Game, depth int8, ply uint16, cmd string) {
+	if uci.ownBook && uci.book != nil && int(game.MoveClock())/2 < uci.bookDepth {
+		move, ok := uci.book.Probe(game.Position(), uci.bestBookMove)
+		if ok {
+			fmt.Printf("bestmove %s\n", move.ToString())
+			return
+		}
+	}
+
 	fields := strings.Fields(cmd)
 
 	pos := game.Position()
-	noTC := false
-	timeToThink := 0
-	inc := 0
-	movesToGo := 0
-	perMove := false
+	limits := Limits{Depth: depth, MoveOverhead: int64(uci.moveOverhead), Ply: ply}
+	timeToThink := int64(0)
+	infinite := false
 	for i := 0; i < len(fields); i++ {
 		switch fields[i] {
 		case "wtime":
 			if pos.Turn() == White {
-				timeToThink, _ = strconv.Atoi(fields[i+1])
+				timeToThink, _ = strconv.ParseInt(fields[i+1], 10, 64)
 				i++
 			}
 		case "btime":
 			if pos.Turn() == Black {
-				timeToThink, _ = strconv.Atoi(fields[i+1])
+				timeToThink, _ = strconv.ParseInt(fields[i+1], 10, 64)
 				i++
 			}
 		case "winc":
 			if pos.Turn() == White {
-				inc, _ = strconv.Atoi(fields[i+1])
+				limits.Increment, _ = strconv.ParseInt(fields[i+1], 10, 64)
 				i++
 			}
 		case "binc":
 			if pos.Turn() == Black {
-				inc, _ = strconv.Atoi(fields[i+1])
+				limits.Increment, _ = strconv.ParseInt(fields[i+1], 10, 64)
 				i++
 			}
+		case "nodes":
+			limits.Nodes, _ = strconv.ParseInt(fields[i+1], 10, 64)
+			i++
 		case "movestogo":
-			movesToGo, _ = strconv.Atoi(fields[i+1])
+			limits.MovesToGo, _ = strconv.Atoi(fields[i+1])
 			i++
 		case "depth":
 			newPly, _ := strconv.Atoi(fields[i+1])
-			depth = int8(newPly)
+			limits.Depth = int8(newPly)
 			i++
 		case "movetime":
-			timeToThink, _ = strconv.Atoi(fields[i+1])
-			perMove = true
+			limits.MoveTime, _ = strconv.ParseInt(fields[i+1], 10, 64)
 			i++
 		case "infinite":
-			noTC = true
+			infinite = true
+		}
+	}
+
+	if infinite {
+		limits.MoveTime = 0
+	} else if limits.MoveTime == 0 {
+		limits.Time = timeToThink
+	}
+	limits.Contempt = uci.contemptFor(pos.Turn(), infinite || uci.analyseMode)
+	limits.ScaleContempt = uci.scaleContempt
+
+	result := uci.engine.Search(context.Background(), game.Position(), limits)
+	if result.PonderMove != EmptyMove {
+		fmt.Printf("bestmove %s ponder %s\n", result.BestMove.ToString(), result.PonderMove.ToString())
+	} else {
+		fmt.Printf("bestmove %s\n", result.BestMove.ToString())
+	}
+}
+
+// contemptFor is the contempt of the side to move, in analysis the contempt is
+// only applied to the sides that are chosen by the Analysis Contempt option, to
+// keep the analysis neutral by default
+func (uci *UCI) contemptFor(turn Color, isAnalysis bool) int32 {
+	if !isAnalysis {
+		return uci.contempt
+	}
+	switch uci.analysisContempt {
+	case "Both":
+		return uci.contempt
+	case "White":
+		if turn == White {
+			return uci.contempt
 		}
+		return -uci.contempt
+	case "Black":
+		if turn == Black {
+			return uci.contempt
+		}
+		return -uci.contempt
 	}
+	return 0
+}
 
-	if !noTC {
-		uci.engine.InitiateTimer(&game, timeToThink, perMove, inc, movesToGo)
-		uci.engine.Search(game.Position(), depth, ply)
-		uci.engine.SendBestMove()
+// updateSkill weakens the engine, UCI_Elo takes precedence over Skill Level
+// when UCI_LimitStrength is on
+func (uci *UCI) updateSkill() {
+	if uci.limitStrength {
+		uci.engine.Skill = SkillFromElo(uci.elo)
 	} else {
-		uci.engine.ThinkTime = 9_223_372_036_854_775_807
-		uci.engine.Search(game.Position(), depth, ply)
-		uci.engine.SendBestMove()
+		uci.engine.Skill = NewSkill(uci.skillLevel)
+	}
+}
+
+// updateNetwork evaluates with the network when it is enabled and loaded, and with
+// the hand crafted evaluation otherwise
+func (uci *UCI) updateNetwork() {
+	if uci.useNetwork && uci.network != nil {
+		SetNetwork(uci.network)
+	} else {
+		SetNetwork(nil)
+	}
+	if uci.useNetwork && uci.network == nil {
+		fmt.Print("info string no network is loaded, using the hand crafted evaluation\n")
 	}
 }
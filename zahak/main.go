@@ -1,16 +1,26 @@
 package main
 
 import (
+	"compress/gzip"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"runtime"
 	"runtime/pprof"
 	"strconv"
 	"strings"
+	"time"
 
+	. "github.com/amanjpro/zahak/book"
+	. "github.com/amanjpro/zahak/cache"
+	. "github.com/amanjpro/zahak/datagen"
 	. "github.com/amanjpro/zahak/engine"
+	. "github.com/amanjpro/zahak/evaluation"
 	. "github.com/amanjpro/zahak/perft"
+	. "github.com/amanjpro/zahak/search"
+	. "github.com/amanjpro/zahak/tuning"
 	. "github.com/amanjpro/zahak/uci"
 )
 
@@ -19,7 +29,49 @@ func main() {
 	var slowFlag = flag.Bool("slow", false, "Run all perft tests, even the very slow tests")
 	var perftTreeFlag = flag.Bool("perft-tree", false, "Run the engine in prefttree mode")
 	var profileFlag = flag.Bool("profile", false, "Run the engine in profiling mode")
+	var makeBookFlag = flag.Bool("make-book", false, "Build a polyglot opening book from the PGN files passed as arguments")
+	var bookOutput = flag.String("book-output", "book.bin", "Path of the opening book that -make-book writes")
+	var bookPly = flag.Int("book-ply", 20, "Number of half-moves of every game that are added to the opening book")
+	var bookMinElo = flag.Int("book-min-elo", 0, "Only add games where both players are rated at least this much")
+	var bookMinCount = flag.Int("book-min-count", 1, "Only keep moves that are played at least this many times")
+	var bookResults = flag.String("book-results", "1-0,0-1,1/2-1/2", "Comma separated results of the games to add to the opening book")
+	var skillGauntletFlag = flag.Bool("skill-gauntlet", false, "Play every skill level against the level below it, and fit the Elo of the levels")
+	var skillGauntletGames = flag.Int("skill-gauntlet-games", 200, "Number of games between every two levels of -skill-gauntlet")
+	var skillGauntletSeed = flag.Int64("skill-gauntlet-seed", 1, "Seed of the random openings of -skill-gauntlet")
+	var fitWDLFlag = flag.String("fit-wdl", "", "Fit the win-draw-loss model to the scores and results of the positions of this file")
+	var evalParams = flag.String("eval-params", "", "Path of a JSON file with the evaluation parameters to use")
+	var saveEvalParams = flag.String("save-eval-params", "", "Write the evaluation parameters in use to this JSON file, and exit")
+	var tuneFlag = flag.String("tune", "", "Tune the evaluation parameters on this dataset of positions and game results")
+	var tuneOutput = flag.String("tune-output", "tuned.json", "Path of the JSON file that -tune writes the parameters to")
+	var tunePasses = flag.Int("tune-passes", 0, "The maximum number of passes of -tune over the parameters, 0 means until no weight changes")
+	var tuneThreads = flag.Int("tune-threads", runtime.NumCPU(), "Number of threads that -tune computes the error with")
+	var datagenFlag = flag.String("datagen", "", "Play self-play games and write their positions, scores and results to this file")
+	var datagenGames = flag.Int("datagen-games", 1000, "Number of games that -datagen plays")
+	var datagenThreads = flag.Int("datagen-threads", runtime.NumCPU(), "Number of games that -datagen plays concurrently")
+	var datagenDepth = flag.Int("datagen-depth", 8, "Depth of the search of every move of -datagen, 0 for no limit")
+	var datagenNodes = flag.Int64("datagen-nodes", 0, "Nodes of the search of every move of -datagen, 0 for no limit")
+	var datagenRandomPlies = flag.Int("datagen-random-plies", 8, "Number of random moves the games of -datagen start with")
+	var datagenMaxPlies = flag.Int("datagen-max-plies", 400, "Games of -datagen that last longer are drawn")
+	var datagenBook = flag.String("datagen-book", "", "Polyglot book the games of -datagen start with, before the random moves")
+	var datagenHash = flag.Int("datagen-hash", 256, "Size of the transposition table of -datagen in megabytes")
+	var datagenFormat = flag.String("datagen-format", "text", "Format of the positions that -datagen writes, text or binary")
+	var datagenSeed = flag.Int64("datagen-seed", 0, "Seed of the random openings of -datagen, 0 for a new seed every time")
 	flag.Parse()
+	if *evalParams != "" {
+		params, err := LoadEvalParams(*evalParams)
+		if err != nil {
+			fmt.Println("could not load the evaluation parameters: ", err)
+			os.Exit(1)
+		}
+		SetEvalParams(params)
+	}
+	if *saveEvalParams != "" {
+		if err := CurrentEvalParams().Save(*saveEvalParams); err != nil {
+			fmt.Println("could not save the evaluation parameters: ", err)
+			os.Exit(1)
+		}
+		return
+	}
 	if *profileFlag {
 		cpu, err := os.Create("zahak-engine-cpu-profile")
 		if err != nil {
@@ -38,7 +90,71 @@ func main() {
 		defer pprof.StopCPUProfile()
 		defer mem.Close() // error handling omitted for example
 	}
-	if *perftFlag {
+	if *datagenFlag != "" {
+		options := Options{
+			Games:       *datagenGames,
+			Threads:     *datagenThreads,
+			Depth:       int8(*datagenDepth),
+			Nodes:       *datagenNodes,
+			RandomPlies: *datagenRandomPlies,
+			MaxPlies:    *datagenMaxPlies,
+			Seed:        *datagenSeed,
+		}
+		if options.Seed == 0 {
+			options.Seed = time.Now().UnixNano()
+		}
+		switch *datagenFormat {
+		case "text":
+			options.Format = TextFormat
+		case "binary":
+			options.Format = BinaryFormat
+		default:
+			fmt.Println("unknown -datagen-format: ", *datagenFormat)
+			os.Exit(1)
+		}
+		if *datagenBook != "" {
+			book, err := LoadBook(*datagenBook)
+			if err != nil {
+				fmt.Println("could not load the opening book: ", err)
+				os.Exit(1)
+			}
+			options.Book = book
+		}
+		datagen(*datagenFlag, options, *datagenHash)
+	} else if *tuneFlag != "" {
+		tune(*tuneFlag, *tuneOutput, *tunePasses, *tuneThreads)
+	} else if *makeBookFlag {
+		builder := NewBookBuilder(BuilderOptions{
+			MaxPly:   *bookPly,
+			MinElo:   *bookMinElo,
+			MinCount: *bookMinCount,
+			Results:  strings.Split(*bookResults, ","),
+		})
+		for _, path := range flag.Args() {
+			pgn, err := os.Open(path)
+			if err != nil {
+				fmt.Println("could not open PGN file: ", err)
+				os.Exit(1)
+			}
+			added, err := builder.AddPGN(pgn)
+			pgn.Close()
+			if err != nil {
+				fmt.Printf("could not read %s: %s\n", path, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Added %d games from %s\n", added, path)
+		}
+		written, err := builder.Write(*bookOutput)
+		if err != nil {
+			fmt.Println("could not write the opening book: ", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote %d entries from %d games to %s\n", written, builder.Games(), *bookOutput)
+	} else if *skillGauntletFlag {
+		skillGauntlet(*skillGauntletGames, *skillGauntletSeed)
+	} else if *fitWDLFlag != "" {
+		fitWDL(*fitWDLFlag)
+	} else if *perftFlag {
 		StartPerftTest(*slowFlag)
 	} else if *perftTreeFlag {
 		depth, _ := strconv.Atoi(flag.Arg(0))
@@ -53,3 +169,103 @@ func main() {
 		NewUCI().Start()
 	}
 }
+
+func skillGauntlet(games int, seed int64) {
+	NewCache(16) // Cleared before every move, a small table is enough
+	pairs := SkillGauntlet(context.Background(), GauntletOptions{
+		Games:       games,
+		RandomPlies: 8,
+		Seed:        seed,
+		OnPair: func(pair GauntletPair) {
+			fmt.Printf("Level %d vs %d: %.1f/%d, %+.0f +/- %.0f Elo\n", pair.Level, pair.Level-1,
+				pair.Points, pair.Games, pair.Elo(), pair.EloError())
+		},
+	})
+	elos := FitSkillElos(pairs)
+	fmt.Print("Fitted Elo of every level, relative to level 0:")
+	for _, elo := range elos {
+		fmt.Printf(" %.0f", elo)
+	}
+	fmt.Println()
+}
+
+func fitWDL(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Println("could not open the data file: ", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		if reader, err = gzip.NewReader(file); err != nil {
+			fmt.Printf("could not read %s: %s\n", path, err)
+			os.Exit(1)
+		}
+	}
+	samples, err := ReadWDLSamples(reader)
+	if err != nil {
+		fmt.Printf("could not read %s: %s\n", path, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Loaded %d positions from %s\n", len(samples), path)
+	model := FitWDLModel(samples, DefaultWDLModel)
+	fmt.Printf("WDLModel{%.0f, %.0f, %.0f, %.0f}\n", model.OpeningA, model.EndgameA, model.OpeningB, model.EndgameB)
+}
+
+func tune(path string, output string, passes int, threads int) {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Println("could not open the dataset: ", err)
+		os.Exit(1)
+	}
+	dataset, err := ReadDataset(file)
+	file.Close()
+	if err != nil {
+		fmt.Printf("could not read %s: %s\n", path, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Loaded %d positions from %s\n", dataset.Len(), path)
+
+	tuner := NewTuner(dataset, threads)
+	params := CurrentEvalParams()
+	k := tuner.FitK(&params)
+	fmt.Printf("K: %.4f, error: %.6f\n", k, tuner.Error(&params, k))
+
+	save := func(params EvalParams) {
+		if err := params.Save(output); err != nil {
+			fmt.Println("could not save the evaluation parameters: ", err)
+			os.Exit(1)
+		}
+	}
+	// The parameters are saved after every pass, so that a long tuning can be interrupted
+	tuned := tuner.Tune(params, passes, func(pass int, params EvalParams, err float64) {
+		fmt.Printf("Pass %d, error: %.6f\n", pass, err)
+		save(params)
+	})
+	save(tuned)
+	fmt.Printf("Wrote the tuned parameters to %s\n", output)
+}
+
+func datagen(path string, options Options, hash int) {
+	file, err := os.Create(path)
+	if err != nil {
+		fmt.Println("could not create the data file: ", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+	NewCache(uint32(hash))
+
+	start := time.Now()
+	options.OnGame = func(games int, positions int) {
+		if games%100 == 0 {
+			fmt.Printf("Played %d games, %d positions, in %s\n", games, positions, time.Since(start).Round(time.Second))
+		}
+	}
+	games, positions, err := NewGenerator(options, file).Run(context.Background())
+	if err != nil {
+		fmt.Println("could not write the data: ", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote %d positions from %d games to %s\n", positions, games, path)
+}